@@ -207,13 +207,7 @@ func (exe *HTTPRemote) Execute(param map[string]interface{}) (map[string]interfa
 		return result, errors.New("Unknown media type")
 	}
 
-	exitCodeFloat, err := util.GetFloatParam(result, "exit_code")
-	exitCode := int(exitCodeFloat)
-	if exitCode != 0 {
-		return result, fmt.Errorf("Command failed with code %d", exitCode)
-	}
-
-	return result, nil
+	return result, util.CheckCommandResult(result)
 }
 
 func newExecutorHTTPRemote(param map[string]interface{}) interface{} {
@@ -1,7 +1,7 @@
 package executor
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/heraldgo/heraldd/util"
 )
@@ -18,20 +18,41 @@ func (exe *Local) Execute(param map[string]interface{}) (map[string]interface{},
 		return result, err
 	}
 
-	exitCode, _ := util.GetIntParam(result, "exit_code")
-	if exitCode != 0 {
-		return result, fmt.Errorf("Command failed with code %d", exitCode)
-	}
-
-	return result, nil
+	return result, util.CheckCommandResult(result)
 }
 
 func newExecutorLocal(param map[string]interface{}) interface{} {
 	workDir, _ := util.GetStringParam(param, "work_dir")
+	timeout, _ := util.GetIntParam(param, "timeout")
+	killGrace, err := util.GetIntParam(param, "kill_grace")
+	if err != nil {
+		killGrace = 10
+	}
+	maxOutput, _ := util.ParseSize(param["max_output_size"])
+	logOutput, _ := util.GetBoolParam(param, "log_output")
+	logKeep, err := util.GetIntParam(param, "log_keep")
+	if err != nil {
+		logKeep = 20
+	}
+	logMaxAge, _ := util.GetIntParam(param, "log_max_age")
+	shellInterpreter, _ := util.GetStringSliceParam(param, "shell_interpreter")
+	paramMode, _ := util.GetStringParam(param, "param_mode")
+	paramFlatten, _ := util.GetBoolParam(param, "param_flatten")
 
 	exe := &Local{
 		ExeGit: util.ExeGit{
-			WorkDir: workDir,
+			WorkDir:   workDir,
+			Timeout:   time.Duration(timeout) * time.Second,
+			KillGrace: time.Duration(killGrace) * time.Second,
+			MaxOutput: int64(maxOutput),
+			LogOutput: logOutput,
+			LogKeep:   logKeep,
+			LogMaxAge: time.Duration(logMaxAge) * time.Second,
+
+			ProcessParam:     util.MergeProcessParam(nil, param),
+			ShellInterpreter: shellInterpreter,
+			ParamMode:        paramMode,
+			ParamFlatten:     paramFlatten,
 		},
 	}
 	return exe
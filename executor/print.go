@@ -25,6 +25,7 @@ func (exe *Print) Execute(param map[string]interface{}) (map[string]interface{},
 		for _, key := range printKeys {
 			value, err := util.GetNestedMapValue(param, key)
 			if err != nil {
+				exe.Debugf("Print key ignored: %s", err)
 				continue
 			}
 			resultParam[key] = value
@@ -6,7 +6,9 @@ require (
 	github.com/heraldgo/herald v1.6.1
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/sirupsen/logrus v1.5.0
+	go.starlark.net v0.0.0-20201204201740-42d4f566359b
 	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.15.0
 	gopkg.in/src-d/go-git.v4 v4.13.1
 	gopkg.in/yaml.v2 v2.2.8
 )
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"plugin"
+	"strings"
+	"sync"
 
 	"github.com/heraldgo/herald"
 
@@ -16,8 +20,18 @@ import (
 var pluginComponents = [3]string{"trigger", "executor", "selector"}
 var pluginFuncs = [3]string{"CreateTrigger", "CreateExecutor", "CreateSelector"}
 
+// exeBackgroundDoneName is the trigger always registered like "exe_done"
+const exeBackgroundDoneName = "exe_background_done"
+
 type mapParam map[string]interface{}
 
+var stateDir string
+
+var labels map[string]interface{}
+
+var pause *pauseChecker
+var pauseExeDone bool
+
 type mapCreator map[string]func(string, map[string]interface{}) (interface{}, error)
 type mapPlugin map[string]mapCreator
 
@@ -26,6 +40,33 @@ type LoggerSetter interface {
 	SetLogger(interface{})
 }
 
+// SelectParamValidator should validate the select param for each task
+type SelectParamValidator interface {
+	ValidateSelectParam(map[string]interface{}) error
+}
+
+// LabelSetter should receive the labels of the daemon
+type LabelSetter interface {
+	SetLabels(map[string]interface{})
+}
+
+// TaskSelectParamSetter should set the info of router and task into select param
+type TaskSelectParamSetter interface {
+	SetTaskSelectParam(router, task string, selectParam map[string]interface{})
+}
+
+// SelectorLinker should link other named selectors
+type SelectorLinker interface {
+	SelectorNames() []string
+	LinkSelector(func(string) interface{}) error
+}
+
+// TriggerRefireSetter should receive the function to fire the trigger of
+// the task again, and return whether the function is used
+type TriggerRefireSetter interface {
+	SetTriggerRefire(selectParam map[string]interface{}, refire func(map[string]interface{})) bool
+}
+
 func loadParamAndType(name string, param interface{}) (string, map[string]interface{}, error) {
 	paramMap, ok := param.(map[string]interface{})
 	if !ok {
@@ -54,6 +95,22 @@ func loadParamAndType(name string, param interface{}) (string, map[string]interf
 	return typeName, newParam, nil
 }
 
+// loadStateParam sets the default state file in the state directory
+func loadStateParam(component, name string, param map[string]interface{}) map[string]interface{} {
+	if stateDir == "" {
+		return param
+	}
+
+	if _, ok := param["state_file"]; ok {
+		return param
+	}
+
+	newParam := make(map[string]interface{})
+	util.MergeMapParam(newParam, param)
+	newParam["state_file"] = filepath.Join(stateDir, component, name+".json")
+	return newParam
+}
+
 func setLogger(ifc interface{}, prefix string) {
 	lgr, ok := ifc.(LoggerSetter)
 	if ok {
@@ -64,6 +121,188 @@ func setLogger(ifc interface{}, prefix string) {
 	}
 }
 
+func setLabels(ifc interface{}) {
+	lbs, ok := ifc.(LabelSetter)
+	if ok {
+		lbs.SetLabels(util.DeepCopyMapParam(labels))
+	}
+}
+
+// labelExecutor adds the labels into the execution param
+type labelExecutor struct {
+	herald.Executor
+}
+
+func (exe *labelExecutor) Execute(param map[string]interface{}) (map[string]interface{}, error) {
+	param["labels"] = util.DeepCopyMapParam(labels)
+	return exe.Executor.Execute(param)
+}
+
+// loadLabels merges the labels in config into the default labels
+func loadLabels(cfg map[string]interface{}) map[string]interface{} {
+	result := util.DefaultLabels()
+
+	cfgLabels, _ := util.GetMapParam(cfg, "labels")
+	for k, v := range cfgLabels {
+		result[k] = v
+	}
+
+	log.Debugf("Labels: %v", result)
+	return result
+}
+
+// pauseChecker checks whether the pause file exists
+type pauseChecker struct {
+	file   util.ReloadFile
+	mutex  sync.Mutex
+	paused bool
+}
+
+func (p *pauseChecker) isPaused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	content, exists, changed, err := p.file.Load()
+	if err != nil {
+		log.Errorf(`Check pause file "%s" error: %s`, p.file.Path, err)
+		return p.paused
+	}
+
+	if changed && exists != p.paused {
+		if exists {
+			log.Warnf(`Paused by file "%s": %s`, p.file.Path, strings.TrimSpace(string(content)))
+		} else {
+			log.Infof(`Resumed as pause file "%s" removed`, p.file.Path)
+		}
+	}
+	p.paused = exists
+	return exists
+}
+
+// pauseSelector refuses the selections while paused,
+// except for the tasks with ignore_pause in select param
+type pauseSelector struct {
+	herald.Selector
+}
+
+func (slt *pauseSelector) Select(triggerParam, selectParam map[string]interface{}) bool {
+	ignorePause, _ := util.GetBoolParam(selectParam, "ignore_pause")
+	if !ignorePause && pause.isPaused() {
+		return false
+	}
+	return slt.Selector.Select(triggerParam, selectParam)
+}
+
+// isRouterPausable checks whether the router should be paused by the pause file
+func isRouterPausable(paramMap map[string]interface{}, trigger string) bool {
+	ignorePause, _ := util.GetBoolParam(paramMap, "ignore_pause")
+	if ignorePause {
+		return false
+	}
+	if (trigger == "exe_done" || trigger == exeBackgroundDoneName) && !pauseExeDone {
+		return false
+	}
+	return true
+}
+
+// wrapPauseSelector replaces the selectors with the pausable ones under
+// the same names, which must be done after all the routers are loaded
+func wrapPauseSelector(h *herald.Herald, selectors map[string]bool) {
+	for name := range selectors {
+		err := h.RegisterSelector(name, &pauseSelector{Selector: h.GetSelector(name)})
+		if err != nil {
+			log.Errorf(`Register pausable selector "%s" error: %s`, name, err)
+		}
+	}
+}
+
+// refireTrigger runs the original trigger,
+// and also sends the params fired again by the selectors
+type refireTrigger struct {
+	herald.Trigger
+
+	mutex  sync.Mutex
+	params []map[string]interface{}
+	notify chan struct{}
+}
+
+func (tgr *refireTrigger) refire(param map[string]interface{}) {
+	tgr.mutex.Lock()
+	tgr.params = append(tgr.params, param)
+	tgr.mutex.Unlock()
+
+	select {
+	case tgr.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (tgr *refireTrigger) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tgr.Trigger.Run(ctx, sendParam)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-done
+			return
+		case <-tgr.notify:
+			tgr.mutex.Lock()
+			params := tgr.params
+			tgr.params = nil
+			tgr.mutex.Unlock()
+
+			for _, param := range params {
+				sendParam(param)
+			}
+		}
+	}
+}
+
+// refireSelector only passes the fired again events
+// to the task with the same throttle key
+type refireSelector struct {
+	herald.Selector
+}
+
+func (slt *refireSelector) Select(triggerParam, selectParam map[string]interface{}) bool {
+	debounce, err := util.GetMapParam(triggerParam, selector.ThrottleDebounceKey)
+	if err == nil {
+		throttleKey, _ := util.GetStringParam(selectParam, "throttle_key")
+		debounceKey, _ := util.GetStringParam(debounce, "throttle_key")
+		if throttleKey != debounceKey {
+			return false
+		}
+	}
+	return slt.Selector.Select(triggerParam, selectParam)
+}
+
+// wrapRefire replaces the triggers with events fired again, and the
+// selectors of the routers on these triggers, under the same names
+func wrapRefire(h *herald.Herald, triggers map[string]*refireTrigger, routerSelectors map[string]map[string]bool) {
+	selectors := make(map[string]bool)
+	for name, tgr := range triggers {
+		err := h.RegisterTrigger(name, tgr)
+		if err != nil {
+			log.Errorf(`Register trigger "%s" for debounce error: %s`, name, err)
+			continue
+		}
+		for slt := range routerSelectors[name] {
+			selectors[slt] = true
+		}
+	}
+
+	for name := range selectors {
+		err := h.RegisterSelector(name, &refireSelector{Selector: h.GetSelector(name)})
+		if err != nil {
+			log.Errorf(`Register selector "%s" for debounce error: %s`, name, err)
+		}
+	}
+}
+
 func loadCreator(plugins []string) []mapPlugin {
 	creators := make([]mapPlugin, 0, len(plugins)+1)
 
@@ -132,6 +371,8 @@ func createInstance(component, instanceType string, param map[string]interface{}
 }
 
 func createTrigger(h *herald.Herald, name, triggerType string, param map[string]interface{}, creators []mapPlugin) error {
+	param = loadStateParam("trigger", name, param)
+
 	tgrI := createInstance("trigger", triggerType, param, creators, func(ifc interface{}) bool {
 		_, ok := ifc.(herald.Trigger)
 		return ok
@@ -145,6 +386,7 @@ func createTrigger(h *herald.Herald, name, triggerType string, param map[string]
 
 	loggerPrefix := fmt.Sprintf("[Trigger:%s(%s)]", triggerType, name)
 	setLogger(tgr, loggerPrefix)
+	setLabels(tgr)
 
 	err := h.RegisterTrigger(name, tgr)
 	if err != nil {
@@ -167,6 +409,8 @@ func loadTrigger(h *herald.Herald, cfg map[string]interface{}, creators []mapPlu
 }
 
 func createExecutor(h *herald.Herald, name, executorType string, param map[string]interface{}, creators []mapPlugin) error {
+	param = loadStateParam("executor", name, param)
+
 	exeI := createInstance("executor", executorType, param, creators, func(ifc interface{}) bool {
 		_, ok := ifc.(herald.Executor)
 		return ok
@@ -180,8 +424,9 @@ func createExecutor(h *herald.Herald, name, executorType string, param map[strin
 
 	loggerPrefix := fmt.Sprintf("[Executor:%s(%s)]", executorType, name)
 	setLogger(exe, loggerPrefix)
+	setLabels(exe)
 
-	err := h.RegisterExecutor(name, exe)
+	err := h.RegisterExecutor(name, &labelExecutor{Executor: exe})
 	if err != nil {
 		return err
 	}
@@ -202,6 +447,8 @@ func loadExecutor(h *herald.Herald, cfg map[string]interface{}, creators []mapPl
 }
 
 func createSelector(h *herald.Herald, name, selectorType string, param map[string]interface{}, creators []mapPlugin) error {
+	param = loadStateParam("selector", name, param)
+
 	sltI := createInstance("selector", selectorType, param, creators, func(ifc interface{}) bool {
 		_, ok := ifc.(herald.Selector)
 		return ok
@@ -215,6 +462,7 @@ func createSelector(h *herald.Herald, name, selectorType string, param map[strin
 
 	loggerPrefix := fmt.Sprintf("[Selector:%s(%s)]", selectorType, name)
 	setLogger(slt, loggerPrefix)
+	setLabels(slt)
 
 	err := h.RegisterSelector(name, slt)
 	if err != nil {
@@ -236,6 +484,86 @@ func loadSelector(h *herald.Herald, cfg map[string]interface{}, creators []mapPl
 	}
 }
 
+// findSelectorCycle returns the linked selectors which are on a reference cycle
+func findSelectorCycle(h *herald.Herald, cfg map[string]interface{}) map[string]bool {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+	cyclic := make(map[string]bool)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		linker, ok := h.GetSelector(name).(SelectorLinker)
+		if !ok {
+			return
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, child := range linker.SelectorNames() {
+			switch state[child] {
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					cyclic[stack[i]] = true
+					if stack[i] == child {
+						break
+					}
+				}
+			case 0:
+				visit(child)
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for name := range cfg {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+
+	return cyclic
+}
+
+func linkSelector(h *herald.Herald, cfg map[string]interface{}, creators []mapPlugin) {
+	getSelector := func(name string) interface{} {
+		if h.GetSelector(name) == nil {
+			err := createSelector(h, name, name, nil, creators)
+			if err != nil {
+				log.Errorf(`Auto create selector "%s" failed`, name)
+				return nil
+			}
+		}
+		return h.GetSelector(name)
+	}
+
+	cyclic := findSelectorCycle(h, cfg)
+
+	for name := range cfg {
+		linker, ok := h.GetSelector(name).(SelectorLinker)
+		if !ok {
+			continue
+		}
+
+		if cyclic[name] {
+			log.Errorf(`Link selector "%s" error: Recursive reference of child selectors`, name)
+			continue
+		}
+
+		err := linker.LinkSelector(getSelector)
+		if err != nil {
+			log.Errorf(`Link selector "%s" error: %s`, name, err)
+		}
+	}
+}
+
 func loadParamWithPreset(cfg interface{}, cfgPreset map[string]interface{}) map[string]interface{} {
 	param := make(map[string]interface{})
 
@@ -342,6 +670,13 @@ func loadRouterExecutor(h *herald.Herald, cfgTask interface{}, cfgPreset map[str
 }
 
 func loadRouter(h *herald.Herald, cfg, cfgPreset map[string]interface{}, creators []mapPlugin) {
+	pauseSelectors := make(map[string]bool)
+	defer wrapPauseSelector(h, pauseSelectors)
+
+	refireTriggers := make(map[string]*refireTrigger)
+	routerSelectors := make(map[string]map[string]bool)
+	defer wrapRefire(h, refireTriggers, routerSelectors)
+
 	for router, param := range cfg {
 		paramMap, ok := param.(map[string]interface{})
 		if !ok {
@@ -364,6 +699,21 @@ func loadRouter(h *herald.Herald, cfg, cfgPreset map[string]interface{}, creator
 			continue
 		}
 
+		if selector != "" {
+			if routerSelectors[trigger] == nil {
+				routerSelectors[trigger] = make(map[string]bool)
+			}
+			routerSelectors[trigger][selector] = true
+		}
+
+		ignorePause := false
+		if pause != nil && selector != "" {
+			ignorePause = !isRouterPausable(paramMap, trigger)
+			if !ignorePause {
+				pauseSelectors[selector] = true
+			}
+		}
+
 		// Load router param
 		cfgRouterSelectParam, _ := util.GetMapParam(paramMap, "select_param")
 		routerSelectParam := loadParamWithPreset(cfgRouterSelectParam, cfgPreset)
@@ -388,11 +738,42 @@ func loadRouter(h *herald.Herald, cfg, cfgPreset map[string]interface{}, creator
 			selectParam := make(map[string]interface{})
 			util.MergeMapParam(selectParam, routerSelectParam)
 			util.MergeMapParam(selectParam, taskSelectParam)
+			if ignorePause {
+				selectParam["ignore_pause"] = true
+			}
 
 			jobParam := make(map[string]interface{})
 			util.MergeMapParam(jobParam, routerJobParam)
 			util.MergeMapParam(jobParam, taskJobParam)
 
+			setter, ok := h.GetSelector(selector).(TaskSelectParamSetter)
+			if ok {
+				setter.SetTaskSelectParam(router, task, selectParam)
+			}
+
+			refireSetter, ok := h.GetSelector(selector).(TriggerRefireSetter)
+			if ok && trigger != "exe_done" {
+				tgr, ok := refireTriggers[trigger]
+				if !ok {
+					tgr = &refireTrigger{
+						Trigger: h.GetTrigger(trigger),
+						notify:  make(chan struct{}, 1),
+					}
+				}
+				if refireSetter.SetTriggerRefire(selectParam, tgr.refire) {
+					refireTriggers[trigger] = tgr
+				}
+			}
+
+			validator, ok := h.GetSelector(selector).(SelectParamValidator)
+			if ok {
+				err = validator.ValidateSelectParam(selectParam)
+				if err != nil {
+					log.Errorf(`Invalid select param for task "%s" in router "%s": %s`, task, router, err)
+					continue
+				}
+			}
+
 			log.Debugf(`Add task for router "%s", task(%s), executor(%v)`, router, task, executor)
 			err = h.AddRouterTask(router, task, executor, selectParam, jobParam)
 			if err != nil {
@@ -406,17 +787,36 @@ func loadRouter(h *herald.Herald, cfg, cfgPreset map[string]interface{}, creator
 func newHerald(cfg map[string]interface{}) *herald.Herald {
 	h := herald.New(logger)
 
+	stateDir, _ = util.GetStringParam(cfg, "state_dir")
+	labels = loadLabels(cfg)
+
+	pause = nil
+	pauseFile, _ := util.GetStringParam(cfg, "pause_file")
+	if pauseFile != "" {
+		pause = &pauseChecker{
+			file: util.ReloadFile{Path: pauseFile},
+		}
+		pauseExeDone = true
+		if _, ok := cfg["pause_exe_done"]; ok {
+			pauseExeDone, _ = util.GetBoolParam(cfg, "pause_exe_done")
+		}
+	}
+
 	plugins, _ := util.GetStringSliceParam(cfg, "plugin")
 	creators := loadCreator(plugins)
 
 	cfgTrigger, _ := util.GetMapParam(cfg, "trigger")
 	loadTrigger(h, cfgTrigger, creators)
+	if _, ok := cfgTrigger[exeBackgroundDoneName]; !ok {
+		createTrigger(h, exeBackgroundDoneName, exeBackgroundDoneName, map[string]interface{}{}, creators)
+	}
 
 	cfgExecutor, _ := util.GetMapParam(cfg, "executor")
 	loadExecutor(h, cfgExecutor, creators)
 
 	cfgSelector, _ := util.GetMapParam(cfg, "selector")
 	loadSelector(h, cfgSelector, creators)
+	linkSelector(h, cfgSelector, creators)
 
 	cfgPreset, _ := util.GetMapParam(cfg, "preset")
 
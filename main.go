@@ -99,6 +99,10 @@ func printVersion() {
 }
 
 func main() {
+	if util.RunProcessHelper() {
+		return
+	}
+
 	flagVersion := flag.Bool("version", false, "Print Herald Daemon version")
 	flagConfigFile := flag.String("config", "config.yml", "Configuration file path")
 	flag.Parse()
@@ -139,13 +143,15 @@ func main() {
 
 	h.Start()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	log.Infof("Shutdown...")
 
+	util.CancelCommands()
 	h.Stop()
+	util.WaitBackgroundJobs()
 
 	log.Infof("Exit...")
 	log.Infof("%s", strings.Repeat("-", 80))
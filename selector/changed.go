@@ -0,0 +1,235 @@
+package selector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// compileTransition creates the condition for "from" or "to",
+// a string like "!0" means not equal to the rest
+func compileTransition(name string, cond interface{}) (*condition, error) {
+	text, ok := cond.(string)
+	if ok && strings.HasPrefix(text, "!") {
+		var value interface{}
+		err := yaml.Unmarshal([]byte(text[1:]), &value)
+		if err != nil {
+			value = text[1:]
+		}
+		cond = map[string]interface{}{"ne": value}
+	}
+	return compileCondition(name, cond)
+}
+
+type changedConfig struct {
+	watchKey string
+	groupKey string
+	from     *condition
+	to       *condition
+}
+
+// Changed is a selector which only passes when the value
+// of the nested key changes
+type Changed struct {
+	util.BaseLogger
+	DefaultWatchKey string
+	DefaultGroupKey string
+	DefaultFrom     interface{}
+	DefaultTo       interface{}
+	StateFile       string
+
+	mutex  sync.Mutex
+	loaded bool
+	values map[string]map[string]interface{}
+}
+
+// SetLogger will set logger, and warn if the values could not be saved
+func (slt *Changed) SetLogger(logger interface{}) {
+	slt.BaseLogger.SetLogger(logger)
+	if slt.StateFile == "" {
+		slt.Warnf("The previous values are only kept in memory, since neither state_dir nor state_file is specified")
+	}
+}
+
+func (slt *Changed) getConfig(selectParam map[string]interface{}) (*changedConfig, error) {
+	watchKey, err := util.GetStringParam(selectParam, "watch_key")
+	if err != nil {
+		watchKey = slt.DefaultWatchKey
+	}
+	if watchKey == "" {
+		return nil, errors.New("Watch key not specified")
+	}
+
+	groupKey, err := util.GetStringParam(selectParam, "group_key")
+	if err != nil {
+		groupKey = slt.DefaultGroupKey
+	}
+
+	cfg := &changedConfig{
+		watchKey: watchKey,
+		groupKey: groupKey,
+	}
+
+	from, ok := selectParam["from"]
+	if !ok {
+		from = slt.DefaultFrom
+	}
+	if from != nil {
+		cfg.from, err = compileTransition("from", from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	to, ok := selectParam["to"]
+	if !ok {
+		to = slt.DefaultTo
+	}
+	if to != nil {
+		cfg.to, err = compileTransition("to", to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func (slt *Changed) loadState() {
+	if slt.loaded {
+		return
+	}
+	slt.loaded = true
+	slt.values = make(map[string]map[string]interface{})
+
+	if slt.StateFile == "" {
+		return
+	}
+
+	err := util.LoadStateFile(slt.StateFile, &slt.values)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slt.Errorf(`Load state file "%s" error: %s`, slt.StateFile, err)
+		}
+		slt.values = make(map[string]map[string]interface{})
+	}
+}
+
+func (slt *Changed) saveState() {
+	if slt.StateFile == "" {
+		return
+	}
+
+	err := util.SaveStateFile(slt.StateFile, slt.values)
+	if err != nil {
+		slt.Errorf(`Save state file "%s" error: %s`, slt.StateFile, err)
+	}
+}
+
+// groupName gets the value of group key from trigger param
+func groupName(triggerParam map[string]interface{}, groupKey string) string {
+	if groupKey == "" {
+		return ""
+	}
+
+	value, err := util.GetNestedMapValue(triggerParam, groupKey)
+	if err != nil {
+		return ""
+	}
+
+	name, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(name)
+}
+
+// SetTaskSelectParam sets the changed key to keep the state per router and task
+func (slt *Changed) SetTaskSelectParam(router, task string, selectParam map[string]interface{}) {
+	if _, ok := selectParam["changed_key"]; ok {
+		return
+	}
+	selectParam["changed_key"] = router + "/" + task
+}
+
+// ValidateSelectParam will check the watch key and transition
+func (slt *Changed) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getConfig(selectParam)
+	return err
+}
+
+// Select will pass when the value changes from the last one
+func (slt *Changed) Select(triggerParam, selectParam map[string]interface{}) bool {
+	cfg, err := slt.getConfig(selectParam)
+	if err != nil {
+		slt.Errorf("%s", err)
+		return false
+	}
+
+	value, err := util.GetNestedMapValue(triggerParam, cfg.watchKey)
+	if err != nil {
+		slt.Debugf(`Watch key "%s" not found`, cfg.watchKey)
+		return false
+	}
+	value = util.DeepCopyParam(value)
+
+	changedKey, _ := util.GetStringParam(selectParam, "changed_key")
+	group := groupName(triggerParam, cfg.groupKey)
+
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	slt.loadState()
+
+	groupValues, ok := slt.values[changedKey]
+	if !ok {
+		groupValues = make(map[string]interface{})
+		slt.values[changedKey] = groupValues
+	}
+
+	previous, ok := groupValues[group]
+	if ok && util.ValueEqual(previous, value) {
+		return false
+	}
+
+	groupValues[group] = value
+	slt.saveState()
+
+	if !ok {
+		slt.Debugf(`First value of "%s" recorded for "%s": %v`, cfg.watchKey, changedKey, value)
+		return false
+	}
+
+	if cfg.from != nil && !cfg.from.matchValue(previous, true) {
+		slt.Debugf(`Previous value of "%s" does not match: %v`, cfg.watchKey, previous)
+		return false
+	}
+	if cfg.to != nil && !cfg.to.matchValue(value, true) {
+		slt.Debugf(`Current value of "%s" does not match: %v`, cfg.watchKey, value)
+		return false
+	}
+
+	slt.Debugf(`Value of "%s" changed for "%s": %v -> %v`, cfg.watchKey, changedKey, previous, value)
+	return true
+}
+
+func newSelectorChanged(param map[string]interface{}) interface{} {
+	watchKey, _ := util.GetStringParam(param, "watch_key")
+	groupKey, _ := util.GetStringParam(param, "group_key")
+	stateFile, _ := util.GetStringParam(param, "state_file")
+
+	return &Changed{
+		DefaultWatchKey: watchKey,
+		DefaultGroupKey: groupKey,
+		DefaultFrom:     param["from"],
+		DefaultTo:       param["to"],
+		StateFile:       stateFile,
+	}
+}
@@ -0,0 +1,153 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+type selectorI interface {
+	Select(triggerParam, selectParam map[string]interface{}) bool
+}
+
+type selectParamValidatorI interface {
+	ValidateSelectParam(map[string]interface{}) error
+}
+
+type taskSelectParamSetterI interface {
+	SetTaskSelectParam(router, task string, selectParam map[string]interface{})
+}
+
+// Composite is a selector combines other named selectors with and, or, not
+type Composite struct {
+	util.BaseLogger
+	Op    string
+	Names []string
+
+	selectors []selectorI
+	selecting bool
+}
+
+// SelectorNames returns the names of the child selectors
+func (slt *Composite) SelectorNames() []string {
+	return slt.Names
+}
+
+// LinkSelector will get the child selectors by name
+func (slt *Composite) LinkSelector(getSelector func(string) interface{}) error {
+	if len(slt.Names) == 0 {
+		return errors.New("No child selector specified")
+	}
+	if slt.Op == "not" && len(slt.Names) != 1 {
+		return errors.New(`Selector "not" must have exactly one child`)
+	}
+
+	slt.selectors = make([]selectorI, 0, len(slt.Names))
+	for _, name := range slt.Names {
+		child, ok := getSelector(name).(selectorI)
+		if !ok {
+			return fmt.Errorf(`Child selector "%s" not found`, name)
+		}
+		if child == selectorI(slt) {
+			return fmt.Errorf(`Child selector "%s" could not be itself`, name)
+		}
+		slt.selectors = append(slt.selectors, child)
+	}
+
+	return nil
+}
+
+// childParam returns the select param for the child selector, which is
+// in the key of child name, or the whole select param if not found
+func (slt *Composite) childParam(name string, selectParam map[string]interface{}) map[string]interface{} {
+	childParam, err := util.GetMapParam(selectParam, name)
+	if err != nil {
+		return selectParam
+	}
+	return util.DeepCopyMapParam(childParam)
+}
+
+// SetTaskSelectParam will set the task info for each child in place
+func (slt *Composite) SetTaskSelectParam(router, task string, selectParam map[string]interface{}) {
+	for i, child := range slt.selectors {
+		setter, ok := child.(taskSelectParamSetterI)
+		if !ok {
+			continue
+		}
+		childParam, err := util.GetMapParam(selectParam, slt.Names[i])
+		if err != nil {
+			childParam = selectParam
+		}
+		setter.SetTaskSelectParam(router, task, childParam)
+	}
+}
+
+// ValidateSelectParam will validate the select param for each child
+func (slt *Composite) ValidateSelectParam(selectParam map[string]interface{}) error {
+	for i, child := range slt.selectors {
+		validator, ok := child.(selectParamValidatorI)
+		if !ok {
+			continue
+		}
+		err := validator.ValidateSelectParam(slt.childParam(slt.Names[i], selectParam))
+		if err != nil {
+			return fmt.Errorf(`Child selector "%s": %s`, slt.Names[i], err)
+		}
+	}
+	return nil
+}
+
+// Select will combine the results of child selectors with short circuit
+func (slt *Composite) Select(triggerParam, selectParam map[string]interface{}) bool {
+	if len(slt.selectors) == 0 {
+		slt.Errorf("Child selectors not linked")
+		return false
+	}
+
+	if slt.selecting {
+		slt.Errorf("Recursive reference of child selectors")
+		return false
+	}
+	slt.selecting = true
+	defer func() { slt.selecting = false }()
+
+	for i, child := range slt.selectors {
+		name := slt.Names[i]
+		result := child.Select(util.DeepCopyMapParam(triggerParam), slt.childParam(name, selectParam))
+
+		switch slt.Op {
+		case "and":
+			if !result {
+				slt.Debugf(`Child selector "%s" does not pass`, name)
+				return false
+			}
+		case "or":
+			if result {
+				slt.Debugf(`Child selector "%s" passes`, name)
+				return true
+			}
+		case "not":
+			slt.Debugf(`Child selector "%s" result: %t`, name, result)
+			return !result
+		}
+	}
+
+	if slt.Op == "and" {
+		slt.Debugf("All child selectors pass")
+		return true
+	}
+
+	slt.Debugf("None of child selectors passes")
+	return false
+}
+
+func newSelectorComposite(op string) func(map[string]interface{}) interface{} {
+	return func(param map[string]interface{}) interface{} {
+		names, _ := util.GetStringSliceParam(param, "selector")
+		return &Composite{
+			Op:    op,
+			Names: names,
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+var conditionOps = map[string]bool{
+	"eq":     true,
+	"ne":     true,
+	"regex":  true,
+	"glob":   true,
+	"in":     true,
+	"gt":     true,
+	"ge":     true,
+	"lt":     true,
+	"le":     true,
+	"exists": true,
+}
+
+var regexpCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{
+	m: make(map[string]*regexp.Regexp),
+}
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+
+	re, ok := regexpCache.m[pattern]
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.m[pattern] = re
+	return re, nil
+}
+
+type conditionOp struct {
+	op    string
+	value interface{}
+	re    *regexp.Regexp
+}
+
+// condition checks the value of a nested key
+type condition struct {
+	key      string
+	wildcard bool
+	ops      []conditionOp
+}
+
+// compileCondition creates the condition from a value or an operator map,
+// a list value is regarded as "in" operator
+func compileCondition(key string, cond interface{}) (*condition, error) {
+	c := &condition{
+		key:      key,
+		wildcard: util.HasNestedWildcard(key),
+	}
+
+	opMap, ok := cond.(map[string]interface{})
+	if !ok {
+		op := "eq"
+		if _, ok := cond.([]interface{}); ok {
+			op = "in"
+		}
+		opMap = map[string]interface{}{op: cond}
+	}
+
+	opNames := make([]string, 0, len(opMap))
+	for op := range opMap {
+		opNames = append(opNames, op)
+	}
+	sort.Strings(opNames)
+
+	for _, op := range opNames {
+		value := opMap[op]
+		if !conditionOps[op] {
+			return nil, fmt.Errorf(`Unknown operator "%s" for key "%s"`, op, key)
+		}
+
+		cop := conditionOp{
+			op:    op,
+			value: value,
+		}
+
+		switch op {
+		case "regex":
+			pattern, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf(`Regular expression for key "%s" is not a string`, key)
+			}
+			re, err := compileRegexp(pattern)
+			if err != nil {
+				return nil, fmt.Errorf(`Invalid regular expression for key "%s": %s`, key, err)
+			}
+			cop.re = re
+		case "glob":
+			pattern, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf(`Glob pattern for key "%s" is not a string`, key)
+			}
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return nil, fmt.Errorf(`Invalid glob pattern for key "%s": %s`, key, err)
+			}
+		case "in":
+			if _, ok := value.([]interface{}); !ok {
+				return nil, fmt.Errorf(`Value of "in" for key "%s" is not a list`, key)
+			}
+		case "gt", "ge", "lt", "le":
+			if _, ok := util.ToFloat(value); !ok {
+				return nil, fmt.Errorf(`Value of "%s" for key "%s" is not a number`, op, key)
+			}
+		case "exists":
+			if _, ok := value.(bool); !ok {
+				return nil, fmt.Errorf(`Value of "exists" for key "%s" is not a bool`, key)
+			}
+		}
+
+		c.ops = append(c.ops, cop)
+	}
+
+	return c, nil
+}
+
+// compileConditions creates conditions from the map of nested key and condition
+func compileConditions(conds map[string]interface{}) ([]*condition, error) {
+	keys := make([]string, 0, len(conds))
+	for key := range conds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*condition, 0, len(conds))
+	for _, key := range keys {
+		c, err := compileCondition(key, conds[key])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// conditionCache keeps the compiled conditions by the json text of the map,
+// so the conditions of each task are only compiled once
+type conditionCache struct {
+	mutex sync.Mutex
+	cache map[string][]*condition
+}
+
+func (cc *conditionCache) compile(conds map[string]interface{}) ([]*condition, error) {
+	text, err := json.Marshal(conds)
+	if err != nil {
+		return compileConditions(conds)
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if cc.cache == nil {
+		cc.cache = make(map[string][]*condition)
+	}
+
+	result, ok := cc.cache[string(text)]
+	if ok {
+		return result, nil
+	}
+
+	result, err = compileConditions(conds)
+	if err != nil {
+		return nil, err
+	}
+	cc.cache[string(text)] = result
+	return result, nil
+}
+
+func (cop *conditionOp) match(value interface{}) bool {
+	switch cop.op {
+	case "eq":
+		return util.ValueEqual(value, cop.value)
+	case "ne":
+		return !util.ValueEqual(value, cop.value)
+	case "regex":
+		s, ok := value.(string)
+		return ok && cop.re.MatchString(s)
+	case "glob":
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		matched, _ := path.Match(cop.value.(string), s)
+		return matched
+	case "in":
+		for _, item := range cop.value.([]interface{}) {
+			if util.ValueEqual(value, item) {
+				return true
+			}
+		}
+		return false
+	case "gt", "ge", "lt", "le":
+		number, ok := util.ToFloat(value)
+		if !ok {
+			return false
+		}
+		threshold, _ := util.ToFloat(cop.value)
+		switch cop.op {
+		case "gt":
+			return number > threshold
+		case "ge":
+			return number >= threshold
+		case "lt":
+			return number < threshold
+		}
+		return number <= threshold
+	}
+	return false
+}
+
+// matchValue checks the value found or not
+func (c *condition) matchValue(value interface{}, found bool) bool {
+	for _, cop := range c.ops {
+		if cop.op == "exists" {
+			if found != cop.value.(bool) {
+				return false
+			}
+			continue
+		}
+		if !found || !cop.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// match checks the nested key in the param, and any of the values
+// matching the wildcard key
+func (c *condition) match(param map[string]interface{}) bool {
+	if !c.wildcard {
+		value, err := util.GetNestedMapValue(param, c.key)
+		return c.matchValue(value, err == nil)
+	}
+
+	values, err := util.GetNestedMapValues(param, c.key)
+	if err != nil {
+		return c.matchValue(nil, false)
+	}
+	for _, value := range values {
+		if c.matchValue(value, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyValue checks whether any value of the nested key equals to the value
+func matchAnyValue(param map[string]interface{}, nestedKey string, value interface{}, checkValue bool) bool {
+	foundValues, err := util.GetNestedMapValues(param, nestedKey)
+	if err != nil {
+		return false
+	}
+
+	if !checkValue {
+		return true
+	}
+
+	for _, foundValue := range foundValues {
+		if util.ValueEqual(foundValue, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchConditions(conds []*condition, param map[string]interface{}) bool {
+	for _, c := range conds {
+		if !c.match(param) {
+			return false
+		}
+	}
+	return true
+}
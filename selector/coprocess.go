@@ -0,0 +1,160 @@
+package selector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+const coprocessMaxLineSize = 16 * 1024 * 1024
+
+var errCoprocessExited = errors.New("Coprocess exited")
+
+// coprocess is a long running process which answers one line
+// for each line of request
+type coprocess struct {
+	args   []string
+	logger *util.BaseLogger
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+	done  chan struct{}
+}
+
+// start runs the process, which is killed on daemon shutdown
+func (cp *coprocess) start() error {
+	ctx := util.CommandContext()
+	if ctx.Err() != nil {
+		return errors.New("Daemon is shutting down")
+	}
+
+	cmd := exec.CommandContext(ctx, cp.args[0], cp.args[1:]...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf(`Start coprocess "%v" error: %s`, cp.args, err)
+	}
+
+	cp.logger.Infof("Coprocess started: pid(%d)", cmd.Process.Pid)
+
+	lines := make(chan string, 1)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), coprocessMaxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			cp.logger.Warnf("Coprocess stderr: %s", scanner.Text())
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		err := cmd.Wait()
+		if err != nil {
+			cp.logger.Warnf("Coprocess pid(%d) exited: %s", cmd.Process.Pid, err)
+		} else {
+			cp.logger.Infof("Coprocess pid(%d) exited", cmd.Process.Pid)
+		}
+	}()
+
+	cp.cmd = cmd
+	cp.stdin = stdin
+	cp.lines = lines
+	cp.done = done
+	return nil
+}
+
+// stop kills the process, and it will be started again on next request
+func (cp *coprocess) stop() {
+	if cp.cmd == nil {
+		return
+	}
+	close(cp.done)
+	cp.stdin.Close()
+	cp.cmd.Process.Kill()
+	cp.cmd = nil
+}
+
+// request sends one line and waits for one line of response,
+// the process is killed if not finished in timeout, no limit for zero
+func (cp *coprocess) request(req []byte, timeout time.Duration) (string, error) {
+	if cp.cmd == nil {
+		err := cp.start()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The write could block if the process does not read,
+	// so it is also covered by the timeout
+	writeErr := make(chan error, 1)
+	go func(stdin io.Writer) {
+		_, err := stdin.Write(append(req, '\n'))
+		writeErr <- err
+	}(cp.stdin)
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	for {
+		select {
+		case err := <-writeErr:
+			if err != nil {
+				cp.stop()
+				return "", fmt.Errorf("Write to coprocess error: %s", err)
+			}
+			writeErr = nil
+		case line, ok := <-cp.lines:
+			if !ok {
+				cp.stop()
+				return "", errCoprocessExited
+			}
+			return line, nil
+		case <-timeoutC:
+			cp.stop()
+			return "", fmt.Errorf("Coprocess not responding in %s, killed", timeout)
+		}
+	}
+}
@@ -6,26 +6,46 @@ import (
 
 // ExceptMap is a selector only pass when specified key not matched
 type ExceptMap struct {
+	util.BaseLogger
+
+	conds conditionCache
+}
+
+// ValidateSelectParam will check the conditions in advance
+func (slt *ExceptMap) ValidateSelectParam(selectParam map[string]interface{}) error {
+	except, err := util.GetMapParam(selectParam, "except")
+	if err == nil {
+		_, err = slt.conds.compile(except)
+		return err
+	}
+
+	_, err = util.GetStringParam(selectParam, "except_key")
+	if err != nil {
+		slt.Warnf(`Neither "except" nor "except_key" is specified, the selector will never pass`)
+	}
+	return nil
 }
 
 // Select will only pass when key not matched
 func (slt *ExceptMap) Select(triggerParam, selectParam map[string]interface{}) bool {
-	exceptKey, err := util.GetStringParam(selectParam, "except_key")
-	if err != nil {
-		return false
+	except, err := util.GetMapParam(selectParam, "except")
+	if err == nil {
+		conds, err := slt.conds.compile(except)
+		if err != nil {
+			slt.Errorf("Invalid except conditions: %s", err)
+			return false
+		}
+		return !matchConditions(conds, triggerParam)
 	}
 
-	foundValue, err := util.GetNestedMapValue(triggerParam, exceptKey)
+	exceptKey, err := util.GetStringParam(selectParam, "except_key")
 	if err != nil {
-		return true
+		return false
 	}
 
 	exceptValue, ok := selectParam["except_value"]
-	if !ok {
-		return false
-	}
 
-	return foundValue != exceptValue
+	return !matchAnyValue(triggerParam, exceptKey, exceptValue, ok)
 }
 
 func newSelectorExceptMap(map[string]interface{}) interface{} {
@@ -0,0 +1,84 @@
+package selector
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// Expr is a selector which evaluates a bool expression
+type Expr struct {
+	util.BaseLogger
+	DefaultExpr string
+
+	mutex sync.Mutex
+	cache map[string]*util.Expr
+}
+
+func (slt *Expr) compile(text string) (*util.Expr, error) {
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	if slt.cache == nil {
+		slt.cache = make(map[string]*util.Expr)
+	}
+
+	e, ok := slt.cache[text]
+	if ok {
+		return e, nil
+	}
+
+	e, err := util.CompileExpr(text)
+	if err != nil {
+		return nil, err
+	}
+	slt.cache[text] = e
+	return e, nil
+}
+
+func (slt *Expr) getExpr(selectParam map[string]interface{}) (*util.Expr, error) {
+	text, err := util.GetStringParam(selectParam, "expr")
+	if err != nil {
+		text = slt.DefaultExpr
+	}
+	if text == "" {
+		return nil, errors.New("Expression not specified")
+	}
+
+	return slt.compile(text)
+}
+
+// ValidateSelectParam will compile the expression in advance
+func (slt *Expr) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getExpr(selectParam)
+	return err
+}
+
+// Select will only pass when the expression is true
+func (slt *Expr) Select(triggerParam, selectParam map[string]interface{}) bool {
+	e, err := slt.getExpr(selectParam)
+	if err != nil {
+		slt.Errorf("Compile expression error: %s", err)
+		return false
+	}
+
+	result, err := e.EvalBool(map[string]interface{}{
+		"trigger_param": triggerParam,
+		"select_param":  selectParam,
+	})
+	if err != nil {
+		slt.Errorf(`Evaluate expression "%s" error: %s`, e, err)
+		return false
+	}
+
+	slt.Debugf(`Expression "%s" result: %t`, e, result)
+	return result
+}
+
+func newSelectorExpr(param map[string]interface{}) interface{} {
+	defaultExpr, _ := util.GetStringParam(param, "expr")
+	return &Expr{
+		DefaultExpr: defaultExpr,
+	}
+}
@@ -2,6 +2,10 @@ package selector
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/heraldgo/heraldd/util"
 )
@@ -10,49 +14,195 @@ import (
 type External struct {
 	util.BaseLogger
 	Program         string
+	Arg             []string
 	TriggerParamEnv string
 	SelectParamEnv  string
+	Timeout         time.Duration
+	Stdin           bool
+	Decision        string
+	Coprocess       bool
+
+	coprocess *coprocess
 }
 
+const defaultExternalTimeout = 10
+
 const defaultTriggerParamEnvName = "HERALD_TRIGGER_PARAM"
 const defaultSelectParamEnvName = "HERALD_SELECT_PARAM"
 
-// Select will call a sub process to check the exit code
-func (slt *External) Select(triggerParam, selectParam map[string]interface{}) bool {
-	triggerParamJSON, err := json.Marshal(triggerParam)
+type externalRequest struct {
+	TriggerParam map[string]interface{} `json:"trigger_param"`
+	SelectParam  map[string]interface{} `json:"select_param"`
+}
+
+type externalResponse struct {
+	Pass   bool   `json:"pass"`
+	Reason string `json:"reason"`
+}
+
+// parseDecision parses the output of the program, which could be a json
+// like {"pass": true, "reason": "..."}, or text like "true reason..."
+func parseDecision(output string) (bool, string, error) {
+	output = strings.TrimSpace(output)
+
+	if strings.HasPrefix(output, "{") {
+		var resp externalResponse
+		err := json.Unmarshal([]byte(output), &resp)
+		if err != nil {
+			return false, "", fmt.Errorf("Invalid decision json: %s", err)
+		}
+		return resp.Pass, resp.Reason, nil
+	}
+
+	frags := strings.SplitN(output, " ", 2)
+	var reason string
+	if len(frags) > 1 {
+		reason = strings.TrimSpace(frags[1])
+	}
+
+	switch strings.ToLower(frags[0]) {
+	case "true", "pass", "yes":
+		return true, reason, nil
+	case "false", "reject", "no":
+		return false, reason, nil
+	}
+	return false, "", fmt.Errorf(`Invalid decision "%s"`, output)
+}
+
+func (slt *External) runProgram(triggerParam, selectParam map[string]interface{}) (bool, string, error) {
+	args := append([]string{slt.Program}, slt.Arg...)
+
+	var env []string
+	var stdin []byte
+
+	if slt.Stdin {
+		request, err := json.Marshal(&externalRequest{
+			TriggerParam: triggerParam,
+			SelectParam:  selectParam,
+		})
+		if err != nil {
+			return false, "", fmt.Errorf("Generate stdin param failed: %s", err)
+		}
+		stdin = request
+	} else {
+		triggerParamJSON, err := json.Marshal(triggerParam)
+		if err != nil {
+			return false, "", fmt.Errorf("Generate trigger param argument failed: %s", err)
+		}
+
+		selectParamJSON, err := json.Marshal(selectParam)
+		if err != nil {
+			return false, "", fmt.Errorf("Generate selector param argument failed: %s", err)
+		}
+
+		env = []string{
+			slt.TriggerParamEnv + "=" + string(triggerParamJSON),
+			slt.SelectParamEnv + "=" + string(selectParamJSON),
+		}
+	}
+
+	command := &util.Command{
+		Args:    args,
+		Env:     env,
+		Stdin:   stdin,
+		Timeout: slt.Timeout,
+	}
+	result, err := command.Run()
 	if err != nil {
-		slt.Errorf("Generate trigger param argument failed: %s", err)
-		return false
+		return false, "", err
 	}
+	if result.TimedOut {
+		return false, "", fmt.Errorf("Program timed out after %s", slt.Timeout)
+	}
+	if result.Canceled {
+		return false, "", errors.New("Program canceled")
+	}
+
+	exitCode := result.ExitCode
+	stdout := result.Stdout
+	stderr := result.Stderr
+
+	if slt.Decision != "stdout" {
+		if exitCode != 0 {
+			return false, fmt.Sprintf("exit(%d)", exitCode), nil
+		}
+		return true, "", nil
+	}
+
+	if exitCode != 0 {
+		return false, "", fmt.Errorf("Program exits with %d: %s", exitCode, strings.TrimSpace(stderr))
+	}
+	return parseDecision(stdout)
+}
 
-	selectParamJSON, err := json.Marshal(selectParam)
+func (slt *External) askCoprocess(triggerParam, selectParam map[string]interface{}) (bool, string, error) {
+	if slt.coprocess == nil {
+		slt.coprocess = &coprocess{
+			args:   append([]string{slt.Program}, slt.Arg...),
+			logger: &slt.BaseLogger,
+		}
+	}
+
+	request, err := json.Marshal(&externalRequest{
+		TriggerParam: triggerParam,
+		SelectParam:  selectParam,
+	})
 	if err != nil {
-		slt.Errorf("Generate selector param argument failed: %s", err)
+		return false, "", fmt.Errorf("Generate request failed: %s", err)
+	}
+
+	response, err := slt.coprocess.request(request, slt.Timeout)
+	if err != nil {
+		return false, "", err
+	}
+
+	return parseDecision(response)
+}
+
+// Select will call a sub process to check the exit code or output
+func (slt *External) Select(triggerParam, selectParam map[string]interface{}) bool {
+	if slt.Program == "" {
+		slt.Errorf("Program not specified")
 		return false
 	}
 
-	env := []string{
-		slt.TriggerParamEnv + "=" + string(triggerParamJSON),
-		slt.SelectParamEnv + "=" + string(selectParamJSON),
+	var pass bool
+	var reason string
+	var err error
+
+	if slt.Coprocess {
+		pass, reason, err = slt.askCoprocess(triggerParam, selectParam)
+	} else {
+		pass, reason, err = slt.runProgram(triggerParam, selectParam)
 	}
 
-	exitCode, err := util.RunCmd([]string{slt.Program}, "", env, false, nil, nil)
 	if err != nil {
 		slt.Errorf("Run external selector error: %s", err)
 		return false
 	}
-	if exitCode != 0 {
-		slt.Debugf("External selector does not pass: exit(%d), err(%s)", exitCode, err)
+	if !pass {
+		slt.Debugf("External selector does not pass: %s", reason)
 		return false
 	}
 
+	if reason != "" {
+		slt.Debugf("External selector passes: %s", reason)
+	}
 	return true
 }
 
 func newSelectorExternal(param map[string]interface{}) interface{} {
 	program, _ := util.GetStringParam(param, "program")
+	arg, _ := util.GetStringSliceParam(param, "arg")
 	triggerParamEnv, _ := util.GetStringParam(param, "trigger_param_env")
 	selectParamEnv, _ := util.GetStringParam(param, "select_param_env")
+	timeout, err := util.GetIntParam(param, "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = defaultExternalTimeout
+	}
+	paramMode, _ := util.GetStringParam(param, "param_mode")
+	decision, _ := util.GetStringParam(param, "decision")
+	useCoprocess, _ := util.GetBoolParam(param, "coprocess")
 
 	if triggerParamEnv == "" {
 		triggerParamEnv = defaultTriggerParamEnvName
@@ -63,7 +213,12 @@ func newSelectorExternal(param map[string]interface{}) interface{} {
 
 	return &External{
 		Program:         program,
+		Arg:             arg,
 		TriggerParamEnv: triggerParamEnv,
 		SelectParamEnv:  selectParamEnv,
+		Timeout:         time.Duration(timeout) * time.Second,
+		Stdin:           paramMode == "stdin",
+		Decision:        decision,
+		Coprocess:       useCoprocess,
 	}
 }
@@ -0,0 +1,56 @@
+package selector
+
+import (
+	"errors"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// Labels is a selector which matches the labels of the daemon
+type Labels struct {
+	util.BaseLogger
+
+	labels map[string]interface{}
+	conds  conditionCache
+}
+
+// SetLabels will keep the labels of the daemon
+func (slt *Labels) SetLabels(labels map[string]interface{}) {
+	slt.labels = labels
+}
+
+func (slt *Labels) getLabelConditions(selectParam map[string]interface{}) ([]*condition, error) {
+	labelParam, err := util.GetMapParam(selectParam, "label")
+	if err != nil {
+		return nil, errors.New(`Param "label" is not a map`)
+	}
+	return slt.conds.compile(labelParam)
+}
+
+// ValidateSelectParam will check the label conditions
+func (slt *Labels) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getLabelConditions(selectParam)
+	return err
+}
+
+// Select will pass when all the label conditions match
+func (slt *Labels) Select(triggerParam, selectParam map[string]interface{}) bool {
+	conds, err := slt.getLabelConditions(selectParam)
+	if err != nil {
+		slt.Errorf("Invalid label conditions: %s", err)
+		return false
+	}
+
+	for _, c := range conds {
+		if !c.match(slt.labels) {
+			slt.Debugf(`Label "%s" does not match`, c.key)
+			return false
+		}
+	}
+
+	return true
+}
+
+func newSelectorLabels(param map[string]interface{}) interface{} {
+	return &Labels{}
+}
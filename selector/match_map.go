@@ -6,26 +6,46 @@ import (
 
 // MatchMap is a selector only pass when specified key found
 type MatchMap struct {
+	util.BaseLogger
+
+	conds conditionCache
+}
+
+// ValidateSelectParam will check the conditions in advance
+func (slt *MatchMap) ValidateSelectParam(selectParam map[string]interface{}) error {
+	match, err := util.GetMapParam(selectParam, "match")
+	if err == nil {
+		_, err = slt.conds.compile(match)
+		return err
+	}
+
+	_, err = util.GetStringParam(selectParam, "match_key")
+	if err != nil {
+		slt.Warnf(`Neither "match" nor "match_key" is specified, the selector will never pass`)
+	}
+	return nil
 }
 
 // Select will only pass when key found
 func (slt *MatchMap) Select(triggerParam, selectParam map[string]interface{}) bool {
-	matchKey, err := util.GetStringParam(selectParam, "match_key")
-	if err != nil {
-		return false
+	match, err := util.GetMapParam(selectParam, "match")
+	if err == nil {
+		conds, err := slt.conds.compile(match)
+		if err != nil {
+			slt.Errorf("Invalid match conditions: %s", err)
+			return false
+		}
+		return matchConditions(conds, triggerParam)
 	}
 
-	foundValue, err := util.GetNestedMapValue(triggerParam, matchKey)
+	matchKey, err := util.GetStringParam(selectParam, "match_key")
 	if err != nil {
 		return false
 	}
 
 	matchValue, ok := selectParam["match_value"]
-	if !ok {
-		return true
-	}
 
-	return foundValue == matchValue
+	return matchAnyValue(triggerParam, matchKey, matchValue, ok)
 }
 
 func newSelectorMatchMap(map[string]interface{}) interface{} {
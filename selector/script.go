@@ -0,0 +1,186 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+const scriptFunctionName = "select"
+
+// Script is a selector which runs embedded starlark script
+type Script struct {
+	util.BaseLogger
+	DefaultScript     string
+	DefaultScriptFile string
+	MaxSteps          uint64
+	Timeout           time.Duration
+
+	mutex sync.Mutex
+	cache map[string]*starlark.Program
+}
+
+func (slt *Script) compile(name, src string) (*starlark.Program, error) {
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	if slt.cache == nil {
+		slt.cache = make(map[string]*starlark.Program)
+	}
+
+	key := name + "\x00" + src
+	prog, ok := slt.cache[key]
+	if ok {
+		return prog, nil
+	}
+
+	isPredeclared := func(string) bool { return false }
+	_, prog, err := starlark.SourceProgram(name, src, isPredeclared)
+	if err != nil {
+		return nil, err
+	}
+	slt.cache[key] = prog
+	return prog, nil
+}
+
+// getProgram compiles the script in select param, or in the script file,
+// the script file is only read once
+func (slt *Script) getProgram(selectParam map[string]interface{}) (*starlark.Program, error) {
+	src, err := util.GetStringParam(selectParam, "script")
+	if err == nil {
+		return slt.compile("script", src)
+	}
+
+	scriptFile, err := util.GetStringParam(selectParam, "script_file")
+	if err != nil {
+		scriptFile = slt.DefaultScriptFile
+	}
+	if scriptFile != "" {
+		slt.mutex.Lock()
+		prog, ok := slt.cache[scriptFile]
+		slt.mutex.Unlock()
+		if ok {
+			return prog, nil
+		}
+
+		content, err := ioutil.ReadFile(scriptFile)
+		if err != nil {
+			return nil, err
+		}
+		prog, err = slt.compile(scriptFile, string(content))
+		if err != nil {
+			return nil, err
+		}
+
+		slt.mutex.Lock()
+		slt.cache[scriptFile] = prog
+		slt.mutex.Unlock()
+		return prog, nil
+	}
+
+	if slt.DefaultScript != "" {
+		return slt.compile("script", slt.DefaultScript)
+	}
+
+	return nil, errors.New("Script not specified")
+}
+
+func (slt *Script) run(prog *starlark.Program, triggerParam, selectParam map[string]interface{}) (bool, error) {
+	triggerValue, err := util.ToStarlarkValue(triggerParam)
+	if err != nil {
+		return false, fmt.Errorf("Convert trigger param error: %s", err)
+	}
+	selectValue, err := util.ToStarlarkValue(selectParam)
+	if err != nil {
+		return false, fmt.Errorf("Convert select param error: %s", err)
+	}
+
+	thread := &starlark.Thread{
+		Name: "selector",
+		Print: func(_ *starlark.Thread, msg string) {
+			slt.Debugf("Script print: %s", msg)
+		},
+	}
+	if slt.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(slt.MaxSteps)
+	}
+
+	timer := time.AfterFunc(slt.Timeout, func() {
+		thread.Cancel("timeout")
+	})
+	defer timer.Stop()
+
+	globals, err := prog.Init(thread, nil)
+	if err != nil {
+		return false, err
+	}
+
+	fn, ok := globals[scriptFunctionName].(starlark.Callable)
+	if !ok {
+		return false, fmt.Errorf(`Function "%s" not defined`, scriptFunctionName)
+	}
+
+	result, err := starlark.Call(thread, fn, starlark.Tuple{triggerValue, selectValue}, nil)
+	if err != nil {
+		return false, err
+	}
+
+	pass, ok := result.(starlark.Bool)
+	if !ok {
+		return false, fmt.Errorf("Result is not a bool: %s", result.Type())
+	}
+	return bool(pass), nil
+}
+
+// ValidateSelectParam will compile the script in advance
+func (slt *Script) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getProgram(selectParam)
+	return err
+}
+
+// Select will pass when the select function returns True
+func (slt *Script) Select(triggerParam, selectParam map[string]interface{}) bool {
+	prog, err := slt.getProgram(selectParam)
+	if err != nil {
+		slt.Errorf("Compile script error: %s", err)
+		return false
+	}
+
+	pass, err := slt.run(prog, triggerParam, selectParam)
+	if err != nil {
+		slt.Errorf("Run script error: %s", err)
+		return false
+	}
+
+	slt.Debugf("Script result: %t", pass)
+	return pass
+}
+
+func newSelectorScript(param map[string]interface{}) interface{} {
+	script, _ := util.GetStringParam(param, "script")
+	scriptFile, _ := util.GetStringParam(param, "script_file")
+	maxSteps, err := util.GetIntParam(param, "max_steps")
+	if err != nil {
+		maxSteps = 1000000
+	}
+	if maxSteps < 0 {
+		maxSteps = 0
+	}
+	timeout, _ := util.GetIntParam(param, "timeout")
+	if timeout <= 0 {
+		timeout = 1
+	}
+
+	return &Script{
+		DefaultScript:     script,
+		DefaultScriptFile: scriptFile,
+		MaxSteps:          uint64(maxSteps),
+		Timeout:           time.Duration(timeout) * time.Second,
+	}
+}
@@ -5,11 +5,21 @@ import (
 )
 
 var selectors = map[string]func(map[string]interface{}) interface{}{
-	"all":        newSelectorAll,
-	"skip":       newSelectorSkip,
-	"match_map":  newSelectorMatchMap,
-	"except_map": newSelectorExceptMap,
-	"external":   newSelectorExternal,
+	"all":              newSelectorAll,
+	"skip":             newSelectorSkip,
+	"match_map":        newSelectorMatchMap,
+	"except_map":       newSelectorExceptMap,
+	"external":         newSelectorExternal,
+	"expr":             newSelectorExpr,
+	"time_window":      newSelectorTimeWindow,
+	"throttle":         newSelectorThrottle,
+	"changed":          newSelectorChanged,
+	"script":           newSelectorScript,
+	"labels":           newSelectorLabels,
+	"system_condition": newSelectorSystemCondition,
+	"and":              newSelectorComposite("and"),
+	"or":               newSelectorComposite("or"),
+	"not":              newSelectorComposite("not"),
 }
 
 // CreateSelector create a new selector
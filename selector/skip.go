@@ -1,26 +1,90 @@
 package selector
 
+import (
+	"sync"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
 // Skip is a selector skip counters regularly
 type Skip struct {
+	util.BaseLogger
+
+	mutex    sync.Mutex
+	counters map[string]int
+}
+
+// counter gets the counter from trigger param, or increases the
+// internal counter of the task if not found
+func (slt *Skip) counter(triggerParam, selectParam map[string]interface{}) int {
+	counterKey, err := util.GetStringParam(selectParam, "counter_key")
+	if err != nil {
+		counterKey = "counter"
+	}
+
+	value, err := util.GetNestedMapValue(triggerParam, counterKey)
+	if err == nil {
+		counter, ok := util.ToFloat(value)
+		if ok {
+			return int(counter)
+		}
+		slt.Warnf(`Counter "%s" is not a number, use internal counter`, counterKey)
+	}
+
+	skipKey, _ := util.GetStringParam(selectParam, "skip_key")
+
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	if slt.counters == nil {
+		slt.counters = make(map[string]int)
+	}
+	slt.counters[skipKey]++
+	return slt.counters[skipKey]
+}
+
+// SetTaskSelectParam sets the skip key to keep the internal counter per router and task
+func (slt *Skip) SetTaskSelectParam(router, task string, selectParam map[string]interface{}) {
+	if _, ok := selectParam["skip_key"]; ok {
+		return
+	}
+	selectParam["skip_key"] = router + "/" + task
 }
 
 // Select will skip certain numbers
 func (slt *Skip) Select(triggerParam, selectParam map[string]interface{}) bool {
-	skipNumber, ok := selectParam["skip_number"]
-	if !ok {
-		return true
-	}
-	skipNumberInt, ok := skipNumber.(int)
-	if !ok || skipNumberInt <= 0 {
-		return true
+	everyN, errEvery := util.GetNumberParam(selectParam, "every_n")
+	firstN, errFirst := util.GetNumberParam(selectParam, "first_n")
+	afterN, errAfter := util.GetNumberParam(selectParam, "after_n")
+
+	if errEvery != nil && errFirst != nil && errAfter != nil {
+		skipNumber, err := util.GetNumberParam(selectParam, "skip_number")
+		if err != nil || skipNumber <= 0 {
+			return true
+		}
+		everyN = skipNumber + 1
+		errEvery = nil
 	}
 
-	counter, ok := triggerParam["counter"]
-	if !ok {
+	offsetNumber, _ := util.GetNumberParam(selectParam, "offset")
+	offset := int(offsetNumber)
+
+	raw := slt.counter(triggerParam, selectParam)
+	counter := raw - offset
+
+	if errEvery == nil {
+		n := int(everyN)
+		if n > 0 && (counter < 0 || counter%n != 0) {
+			slt.Debugf("Counter %d with offset %d skipped for every %d", raw, offset, n)
+			return false
+		}
+	}
+	if errFirst == nil && (counter < 1 || counter > int(firstN)) {
+		slt.Debugf("Counter %d with offset %d skipped for first %d", raw, offset, int(firstN))
 		return false
 	}
-	counterInt, ok := counter.(int)
-	if !ok || counterInt%(skipNumberInt+1) != 0 {
+	if errAfter == nil && counter <= int(afterN) {
+		slt.Debugf("Counter %d with offset %d skipped for after %d", raw, offset, int(afterN))
 		return false
 	}
 
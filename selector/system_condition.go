@@ -0,0 +1,268 @@
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+var systemConditionKeys = []string{
+	"max_load1",
+	"max_load5",
+	"max_load15",
+	"min_free_mem",
+	"min_free_disk",
+	"max_cpu_pressure",
+	"max_memory_pressure",
+	"max_io_pressure",
+	"pressure_window",
+}
+
+type sizeThreshold struct {
+	value   float64
+	percent bool
+}
+
+func (t sizeThreshold) String() string {
+	if t.percent {
+		return fmt.Sprintf("%g%%", t.value)
+	}
+	return formatSize(t.value)
+}
+
+// check returns whether the free size meets the threshold
+func (t sizeThreshold) check(free, total float64) bool {
+	if t.percent {
+		if total == 0 {
+			return false
+		}
+		return free*100/total >= t.value
+	}
+	return free >= t.value
+}
+
+func formatSize(size float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", size, units[i])
+}
+
+type systemCondition struct {
+	maxLoad        map[string]float64
+	minFreeMem     *sizeThreshold
+	minFreeDisk    map[string]sizeThreshold
+	maxPressure    map[string]float64
+	pressureWindow string
+}
+
+func parseSystemCondition(param map[string]interface{}) (*systemCondition, error) {
+	cond := &systemCondition{
+		maxLoad:        make(map[string]float64),
+		minFreeDisk:    make(map[string]sizeThreshold),
+		maxPressure:    make(map[string]float64),
+		pressureWindow: "avg10",
+	}
+
+	for _, name := range []string{"load1", "load5", "load15"} {
+		if _, ok := param["max_"+name]; !ok {
+			continue
+		}
+		value, err := util.GetNumberParam(param, "max_"+name)
+		if err != nil {
+			return nil, err
+		}
+		cond.maxLoad[name] = value
+	}
+
+	if freeMem, ok := param["min_free_mem"]; ok {
+		value, percent, err := util.ParseSizeOrPercent(freeMem)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid min_free_mem: %s", err)
+		}
+		cond.minFreeMem = &sizeThreshold{value: value, percent: percent}
+	}
+
+	if _, ok := param["min_free_disk"]; ok {
+		freeDisk, err := util.GetMapParam(param, "min_free_disk")
+		if err != nil {
+			return nil, err
+		}
+		for path, v := range freeDisk {
+			value, percent, err := util.ParseSizeOrPercent(v)
+			if err != nil {
+				return nil, fmt.Errorf(`Invalid min_free_disk for "%s": %s`, path, err)
+			}
+			cond.minFreeDisk[path] = sizeThreshold{value: value, percent: percent}
+		}
+	}
+
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		key := "max_" + resource + "_pressure"
+		if _, ok := param[key]; !ok {
+			continue
+		}
+		value, err := util.GetNumberParam(param, key)
+		if err != nil {
+			return nil, err
+		}
+		cond.maxPressure[resource] = value
+	}
+
+	if _, ok := param["pressure_window"]; ok {
+		window, _ := util.GetStringParam(param, "pressure_window")
+		switch window {
+		case "avg10", "avg60", "avg300":
+			cond.pressureWindow = window
+		default:
+			return nil, fmt.Errorf(`Invalid pressure_window "%v"`, param["pressure_window"])
+		}
+	}
+
+	return cond, nil
+}
+
+// check returns the measured values and the failures
+func (cond *systemCondition) check() ([]string, []string) {
+	var measured, failures []string
+
+	addError := func(f string, v ...interface{}) {
+		msg := fmt.Sprintf(f, v...)
+		measured = append(measured, msg)
+		failures = append(failures, msg)
+	}
+
+	if len(cond.maxLoad) > 0 {
+		load1, load5, load15, err := util.ReadLoadAvg()
+		if err != nil {
+			addError("read load average error: %s", err)
+		} else {
+			loads := map[string]float64{"load1": load1, "load5": load5, "load15": load15}
+			for _, name := range []string{"load1", "load5", "load15"} {
+				max, ok := cond.maxLoad[name]
+				if !ok {
+					continue
+				}
+				msg := fmt.Sprintf("%s=%.2f (max %g)", name, loads[name], max)
+				measured = append(measured, msg)
+				if loads[name] > max {
+					failures = append(failures, msg)
+				}
+			}
+		}
+	}
+
+	if cond.minFreeMem != nil {
+		memInfo, err := util.ReadMemInfo()
+		if err != nil {
+			addError("read memory info error: %s", err)
+		} else {
+			available, ok := memInfo["MemAvailable"]
+			if !ok {
+				available = memInfo["MemFree"] + memInfo["Buffers"] + memInfo["Cached"]
+			}
+			total := float64(memInfo["MemTotal"])
+			msg := fmt.Sprintf("free_mem=%s/%s (min %s)", formatSize(float64(available)), formatSize(total), cond.minFreeMem)
+			measured = append(measured, msg)
+			if !cond.minFreeMem.check(float64(available), total) {
+				failures = append(failures, msg)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(cond.minFreeDisk))
+	for path := range cond.minFreeDisk {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		threshold := cond.minFreeDisk[path]
+		usage, err := util.ReadDiskUsage(path)
+		if err != nil {
+			addError(`read disk usage of "%s" error: %s`, path, err)
+			continue
+		}
+		available := float64(usage.Available)
+		total := float64(usage.Total - usage.Free + usage.Available)
+		msg := fmt.Sprintf("free_disk[%s]=%s/%s (min %s)", path, formatSize(available), formatSize(total), threshold)
+		measured = append(measured, msg)
+		if !threshold.check(available, total) {
+			failures = append(failures, msg)
+		}
+	}
+
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		max, ok := cond.maxPressure[resource]
+		if !ok {
+			continue
+		}
+		pressure, err := util.ReadPressure(resource)
+		if err != nil {
+			addError("read %s pressure error: %s", resource, err)
+			continue
+		}
+		value := pressure["some"][cond.pressureWindow]
+		msg := fmt.Sprintf("%s_pressure=%.2f (max %g)", resource, value, max)
+		measured = append(measured, msg)
+		if value > max {
+			failures = append(failures, msg)
+		}
+	}
+
+	return measured, failures
+}
+
+// SystemCondition is a selector which only passes when
+// the system load, memory and disk meet the thresholds
+type SystemCondition struct {
+	util.BaseLogger
+	DefaultParam map[string]interface{}
+}
+
+// getCondition merges the conditions of select param into the default
+func (slt *SystemCondition) getCondition(selectParam map[string]interface{}) (*systemCondition, error) {
+	param := make(map[string]interface{})
+	for _, key := range systemConditionKeys {
+		if value, ok := selectParam[key]; ok {
+			param[key] = value
+		} else if value, ok := slt.DefaultParam[key]; ok {
+			param[key] = value
+		}
+	}
+	return parseSystemCondition(param)
+}
+
+// ValidateSelectParam will check the thresholds
+func (slt *SystemCondition) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getCondition(selectParam)
+	return err
+}
+
+// Select will pass when all the thresholds hold
+func (slt *SystemCondition) Select(triggerParam, selectParam map[string]interface{}) bool {
+	cond, err := slt.getCondition(selectParam)
+	if err != nil {
+		slt.Errorf("Invalid system condition: %s", err)
+		return false
+	}
+
+	measured, failures := cond.check()
+	if len(failures) > 0 {
+		slt.Infof("System condition not met: %s", strings.Join(failures, ", "))
+		return false
+	}
+
+	slt.Debugf("System condition met: %s", strings.Join(measured, ", "))
+	return true
+}
+
+func newSelectorSystemCondition(param map[string]interface{}) interface{} {
+	return &SystemCondition{
+		DefaultParam: param,
+	}
+}
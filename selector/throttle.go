@@ -0,0 +1,375 @@
+package selector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+type throttleTaskState struct {
+	Passes []time.Time          `json:"passes,omitempty"`
+	Events map[string]time.Time `json:"events,omitempty"`
+}
+
+// prune removes the records out of the window, and returns whether
+// any record is removed
+func (st *throttleTaskState) prune(since time.Time) bool {
+	count := len(st.Passes) + len(st.Events)
+
+	passes := st.Passes[:0]
+	for _, t := range st.Passes {
+		if t.After(since) {
+			passes = append(passes, t)
+		}
+	}
+	st.Passes = passes
+
+	for k, t := range st.Events {
+		if !t.After(since) {
+			delete(st.Events, k)
+		}
+	}
+
+	return len(st.Passes)+len(st.Events) != count
+}
+
+func (st *throttleTaskState) empty() bool {
+	return len(st.Passes) == 0 && len(st.Events) == 0
+}
+
+// ThrottleDebounceKey is the key in trigger param of the events
+// fired again after the quiet period in debounce mode
+const ThrottleDebounceKey = "throttle_debounce"
+
+type throttleConfig struct {
+	max       int
+	window    time.Duration
+	dedupeKey string
+	leading   bool
+	debounce  bool
+}
+
+// throttleHeld is the latest event of a burst held in debounce mode
+type throttleHeld struct {
+	param  map[string]interface{}
+	events int
+	timer  *time.Timer
+}
+
+// Throttle is a selector which limits the passes in a sliding window
+// and suppresses duplicated or bursting events
+type Throttle struct {
+	util.BaseLogger
+	DefaultMax       int
+	DefaultWindow    int
+	DefaultDedupeKey string
+	DefaultMode      string
+	Persist          bool
+	StateFile        string
+
+	mutex  sync.Mutex
+	loaded bool
+	state  map[string]*throttleTaskState
+	refire map[string]func(map[string]interface{})
+	held   map[string]*throttleHeld
+}
+
+// SetLogger will set logger, and warn if the state could not be saved
+func (slt *Throttle) SetLogger(logger interface{}) {
+	slt.BaseLogger.SetLogger(logger)
+	if slt.Persist && slt.StateFile == "" {
+		slt.Warnf("The state is only kept in memory, since neither state_dir nor state_file is specified for persist")
+	}
+}
+
+func (slt *Throttle) getConfig(selectParam map[string]interface{}) (*throttleConfig, error) {
+	max, err := util.GetIntParam(selectParam, "max")
+	if err != nil {
+		max = slt.DefaultMax
+	}
+	window, err := util.GetIntParam(selectParam, "window")
+	if err != nil {
+		window = slt.DefaultWindow
+	}
+	dedupeKey, err := util.GetStringParam(selectParam, "dedupe_key")
+	if err != nil {
+		dedupeKey = slt.DefaultDedupeKey
+	}
+	mode, err := util.GetStringParam(selectParam, "mode")
+	if err != nil {
+		mode = slt.DefaultMode
+	}
+
+	if window <= 0 {
+		return nil, errors.New("Window must be positive")
+	}
+
+	cfg := &throttleConfig{
+		max:       max,
+		window:    time.Duration(window) * time.Second,
+		dedupeKey: dedupeKey,
+	}
+
+	switch mode {
+	case "", "rate":
+		if max <= 0 && dedupeKey == "" {
+			return nil, errors.New("Either max or dedupe_key must be specified")
+		}
+	case "leading":
+		cfg.leading = true
+	case "debounce":
+		cfg.debounce = true
+	default:
+		return nil, fmt.Errorf(`Invalid mode "%s"`, mode)
+	}
+
+	return cfg, nil
+}
+
+func (slt *Throttle) loadState() {
+	if slt.loaded {
+		return
+	}
+	slt.loaded = true
+	slt.state = make(map[string]*throttleTaskState)
+
+	if !slt.Persist || slt.StateFile == "" {
+		return
+	}
+
+	err := util.LoadStateFile(slt.StateFile, &slt.state)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slt.Errorf(`Load state file "%s" error: %s`, slt.StateFile, err)
+		}
+		slt.state = make(map[string]*throttleTaskState)
+	}
+}
+
+func (slt *Throttle) saveState() {
+	if !slt.Persist || slt.StateFile == "" {
+		return
+	}
+
+	err := util.SaveStateFile(slt.StateFile, slt.state)
+	if err != nil {
+		slt.Errorf(`Save state file "%s" error: %s`, slt.StateFile, err)
+	}
+}
+
+// eventKey gets the value of dedupe key from trigger param,
+// the bool result is false if the dedupe key is not found
+func eventKey(triggerParam map[string]interface{}, dedupeKey string) (string, bool) {
+	if dedupeKey == "" {
+		return "", true
+	}
+
+	value, err := util.GetNestedMapValue(triggerParam, dedupeKey)
+	if err != nil {
+		return "", false
+	}
+
+	key, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value), true
+	}
+	return string(key), true
+}
+
+// SetTaskSelectParam sets the throttle key to keep the state per router and task
+func (slt *Throttle) SetTaskSelectParam(router, task string, selectParam map[string]interface{}) {
+	if _, ok := selectParam["throttle_key"]; ok {
+		return
+	}
+	selectParam["throttle_key"] = router + "/" + task
+}
+
+// SetTriggerRefire keeps the function to fire the trigger of the task again,
+// which is only needed in debounce mode
+func (slt *Throttle) SetTriggerRefire(selectParam map[string]interface{}, refire func(map[string]interface{})) bool {
+	cfg, err := slt.getConfig(selectParam)
+	if err != nil || !cfg.debounce {
+		return false
+	}
+
+	throttleKey, _ := util.GetStringParam(selectParam, "throttle_key")
+
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	if slt.refire == nil {
+		slt.refire = make(map[string]func(map[string]interface{}))
+	}
+	slt.refire[throttleKey] = refire
+	return true
+}
+
+// ValidateSelectParam will check the throttle options
+func (slt *Throttle) ValidateSelectParam(selectParam map[string]interface{}) error {
+	cfg, err := slt.getConfig(selectParam)
+	if err != nil {
+		return err
+	}
+
+	if cfg.debounce {
+		throttleKey, _ := util.GetStringParam(selectParam, "throttle_key")
+
+		slt.mutex.Lock()
+		_, ok := slt.refire[throttleKey]
+		slt.mutex.Unlock()
+		if !ok {
+			return errors.New(`Mode "debounce" only works when throttle is the selector of the router and the trigger is not "exe_done"`)
+		}
+	}
+	return nil
+}
+
+// debounce holds the latest event and restarts the quiet period,
+// the held event is fired again when the quiet period ends
+func (slt *Throttle) debounce(throttleKey, key string, window time.Duration, triggerParam map[string]interface{}) {
+	if slt.held == nil {
+		slt.held = make(map[string]*throttleHeld)
+	}
+
+	heldKey := throttleKey + "\x00" + key
+	h, ok := slt.held[heldKey]
+	if ok {
+		h.timer.Stop()
+		slt.Debugf(`Event "%s" in burst for "%s"`, key, throttleKey)
+	} else {
+		h = &throttleHeld{}
+		slt.held[heldKey] = h
+	}
+	h.param = triggerParam
+	h.events++
+
+	var timer *time.Timer
+	timer = time.AfterFunc(window, func() {
+		slt.mutex.Lock()
+		current, ok := slt.held[heldKey]
+		if !ok || current.timer != timer {
+			slt.mutex.Unlock()
+			return
+		}
+		delete(slt.held, heldKey)
+		refire := slt.refire[throttleKey]
+		slt.mutex.Unlock()
+
+		slt.Debugf(`Fire the last of %d events "%s" for "%s"`, current.events, key, throttleKey)
+		current.param[ThrottleDebounceKey] = map[string]interface{}{
+			"throttle_key": throttleKey,
+			"events":       current.events,
+		}
+		refire(current.param)
+	})
+	h.timer = timer
+}
+
+// Select will pass when the event is not throttled
+func (slt *Throttle) Select(triggerParam, selectParam map[string]interface{}) bool {
+	cfg, err := slt.getConfig(selectParam)
+	if err != nil {
+		slt.Errorf("%s", err)
+		return false
+	}
+
+	throttleKey, _ := util.GetStringParam(selectParam, "throttle_key")
+
+	slt.mutex.Lock()
+	defer slt.mutex.Unlock()
+
+	slt.loadState()
+
+	now := time.Now()
+
+	st, exists := slt.state[throttleKey]
+	if !exists {
+		st = &throttleTaskState{}
+	}
+	if st.Events == nil {
+		st.Events = make(map[string]time.Time)
+	}
+	changed := st.prune(now.Add(-cfg.window))
+
+	defer func() {
+		if st.empty() {
+			if exists {
+				delete(slt.state, throttleKey)
+			}
+		} else {
+			slt.state[throttleKey] = st
+		}
+		if changed {
+			slt.saveState()
+		}
+	}()
+
+	if cfg.debounce {
+		if _, ok := triggerParam[ThrottleDebounceKey]; !ok {
+			key, _ := eventKey(triggerParam, cfg.dedupeKey)
+			slt.debounce(throttleKey, key, cfg.window, triggerParam)
+			return false
+		}
+	}
+
+	key, found := eventKey(triggerParam, cfg.dedupeKey)
+
+	if found && !cfg.debounce {
+		_, seen := st.Events[key]
+		if cfg.leading {
+			// Every event restarts the quiet period of the burst
+			st.Events[key] = now
+			changed = true
+		}
+		if seen {
+			if cfg.leading {
+				slt.Debugf(`Event "%s" in burst for "%s"`, key, throttleKey)
+			} else {
+				slt.Debugf(`Event "%s" deduplicated for "%s"`, key, throttleKey)
+			}
+			return false
+		}
+	}
+
+	if cfg.max > 0 && len(st.Passes) >= cfg.max {
+		slt.Debugf(`Rate limit reached for "%s": %d in %s`, throttleKey, len(st.Passes), cfg.window)
+		return false
+	}
+
+	if cfg.max > 0 {
+		st.Passes = append(st.Passes, now)
+		changed = true
+	}
+	if found && !cfg.leading && !cfg.debounce && cfg.dedupeKey != "" {
+		st.Events[key] = now
+		changed = true
+	}
+
+	return true
+}
+
+func newSelectorThrottle(param map[string]interface{}) interface{} {
+	max, _ := util.GetIntParam(param, "max")
+	window, err := util.GetIntParam(param, "window")
+	if err != nil {
+		window = 60
+	}
+	dedupeKey, _ := util.GetStringParam(param, "dedupe_key")
+	mode, _ := util.GetStringParam(param, "mode")
+	persist, _ := util.GetBoolParam(param, "persist")
+	stateFile, _ := util.GetStringParam(param, "state_file")
+
+	return &Throttle{
+		DefaultMax:       max,
+		DefaultWindow:    window,
+		DefaultDedupeKey: dedupeKey,
+		DefaultMode:      mode,
+		Persist:          persist,
+		StateFile:        stateFile,
+	}
+}
@@ -0,0 +1,497 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun":       time.Sunday,
+	"sunday":    time.Sunday,
+	"mon":       time.Monday,
+	"monday":    time.Monday,
+	"tue":       time.Tuesday,
+	"tuesday":   time.Tuesday,
+	"wed":       time.Wednesday,
+	"wednesday": time.Wednesday,
+	"thu":       time.Thursday,
+	"thursday":  time.Thursday,
+	"fri":       time.Friday,
+	"friday":    time.Friday,
+	"sat":       time.Saturday,
+	"saturday":  time.Saturday,
+}
+
+func parseWeekday(text string) (time.Weekday, error) {
+	day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(text))]
+	if !ok {
+		return 0, fmt.Errorf(`Invalid day "%s"`, text)
+	}
+	return day, nil
+}
+
+// parseClock parses the time of day like "15:04" or "15:04:05"
+func parseClock(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	frags := strings.Split(text, ":")
+	if len(frags) < 2 || len(frags) > 3 {
+		return 0, fmt.Errorf(`Invalid time of day "%s"`, text)
+	}
+
+	limits := []int{24, 60, 60}
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+
+	var clock time.Duration
+	for i, frag := range frags {
+		v, err := strconv.Atoi(frag)
+		if err != nil || v < 0 || v > limits[i] || (i > 0 && v == limits[i]) {
+			return 0, fmt.Errorf(`Invalid time of day "%s"`, text)
+		}
+		clock += time.Duration(v) * units[i]
+	}
+
+	if clock > 24*time.Hour {
+		return 0, fmt.Errorf(`Invalid time of day "%s"`, text)
+	}
+
+	return clock, nil
+}
+
+// clockRange is a range of time of day, which crosses midnight
+// if the end is not after the start
+type clockRange struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func parseClockRange(text string) (clockRange, error) {
+	frags := strings.SplitN(text, "-", 2)
+	if len(frags) != 2 {
+		return clockRange{}, fmt.Errorf(`Invalid time range "%s"`, text)
+	}
+
+	start, err := parseClock(frags[0])
+	if err != nil {
+		return clockRange{}, err
+	}
+	end, err := parseClock(frags[1])
+	if err != nil {
+		return clockRange{}, err
+	}
+
+	return clockRange{
+		start: start,
+		end:   end,
+	}, nil
+}
+
+// contains checks whether t is in the range and returns the offset of
+// days to the day on which the range starts
+func (r clockRange) contains(t time.Time) (bool, int) {
+	clock := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	if r.start < r.end {
+		return clock >= r.start && clock < r.end, 0
+	}
+
+	if clock >= r.start {
+		return true, 0
+	}
+	if clock < r.end {
+		return true, -1
+	}
+	return false, 0
+}
+
+// timePeriod is an absolute period of time, the end is excluded
+type timePeriod struct {
+	start time.Time
+	end   time.Time
+}
+
+func parsePeriodEnd(text string, loc *time.Location, isEnd bool) (time.Time, error) {
+	t, err := util.ParseTime(text, loc)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = util.ParseDate(text, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`Invalid time "%s"`, strings.TrimSpace(text))
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parsePeriod parses the period like "2006-01-02 15:04..2006-01-02 18:00",
+// a date only end includes the whole day
+func parsePeriod(text string, loc *time.Location) (timePeriod, error) {
+	frags := strings.SplitN(text, "..", 2)
+
+	start, err := parsePeriodEnd(frags[0], loc, false)
+	if err != nil {
+		return timePeriod{}, err
+	}
+
+	endText := frags[0]
+	if len(frags) > 1 {
+		endText = frags[1]
+	}
+	end, err := parsePeriodEnd(endText, loc, true)
+	if err != nil {
+		return timePeriod{}, err
+	}
+
+	return timePeriod{
+		start: start,
+		end:   end,
+	}, nil
+}
+
+func (p timePeriod) contains(t time.Time) bool {
+	return !t.Before(p.start) && t.Before(p.end)
+}
+
+// timeWindow matches the time when all the specified conditions match
+type timeWindow struct {
+	days    map[time.Weekday]bool
+	clocks  []clockRange
+	dates   []util.DateRange
+	periods []timePeriod
+}
+
+func parseDays(texts []string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, text := range texts {
+		for _, item := range strings.Split(text, ",") {
+			frags := strings.SplitN(item, "-", 2)
+
+			start, err := parseWeekday(frags[0])
+			if err != nil {
+				return nil, err
+			}
+			end := start
+			if len(frags) > 1 {
+				end, err = parseWeekday(frags[1])
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for day := start; ; day = (day + 1) % 7 {
+				days[day] = true
+				if day == end {
+					break
+				}
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeWindow(param interface{}, loc *time.Location) (*timeWindow, error) {
+	tw := &timeWindow{}
+
+	text, ok := param.(string)
+	if ok {
+		period, err := parsePeriod(text, loc)
+		if err != nil {
+			return nil, err
+		}
+		tw.periods = append(tw.periods, period)
+		return tw, nil
+	}
+
+	windowMap, ok := param.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Time window must be a string or map")
+	}
+
+	days, err := util.GetStringSliceParam(windowMap, "day")
+	if err == nil {
+		tw.days, err = parseDays(days)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clocks, _ := util.GetStringSliceParam(windowMap, "time")
+	for _, text := range clocks {
+		r, err := parseClockRange(text)
+		if err != nil {
+			return nil, err
+		}
+		tw.clocks = append(tw.clocks, r)
+	}
+
+	dates, _ := util.GetStringSliceParam(windowMap, "date")
+	tw.dates, err = util.ParseDateRanges(dates, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	periods, _ := util.GetStringSliceParam(windowMap, "period")
+	for _, text := range periods {
+		period, err := parsePeriod(text, loc)
+		if err != nil {
+			return nil, err
+		}
+		tw.periods = append(tw.periods, period)
+	}
+
+	return tw, nil
+}
+
+func parseTimeWindows(param interface{}, loc *time.Location) ([]*timeWindow, error) {
+	if param == nil {
+		return nil, nil
+	}
+
+	windowSlice, ok := param.([]interface{})
+	if !ok {
+		windowSlice = []interface{}{param}
+	}
+
+	windows := make([]*timeWindow, 0, len(windowSlice))
+	for _, windowParam := range windowSlice {
+		tw, err := parseTimeWindow(windowParam, loc)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, tw)
+	}
+	return windows, nil
+}
+
+func (tw *timeWindow) matchDay(t time.Time) bool {
+	if tw.days != nil && !tw.days[t.Weekday()] {
+		return false
+	}
+
+	if len(tw.dates) == 0 {
+		return true
+	}
+	for _, r := range tw.dates {
+		if r.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tw *timeWindow) contains(t time.Time) bool {
+	if len(tw.periods) > 0 {
+		inPeriod := false
+		for _, p := range tw.periods {
+			if p.contains(t) {
+				inPeriod = true
+				break
+			}
+		}
+		if !inPeriod {
+			return false
+		}
+	}
+
+	if len(tw.clocks) == 0 {
+		return tw.matchDay(t)
+	}
+
+	// The day and date of a range crossing midnight are
+	// checked on the day the range starts
+	for _, r := range tw.clocks {
+		ok, offset := r.contains(t)
+		if ok && tw.matchDay(t.AddDate(0, 0, offset)) {
+			return true
+		}
+	}
+	return false
+}
+
+func windowsContain(windows []*timeWindow, t time.Time) bool {
+	for _, tw := range windows {
+		if tw.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeWindow is a selector which only passes when the activation time
+// is in the included windows and not in the excluded windows
+type TimeWindow struct {
+	util.BaseLogger
+	DefaultInclude  interface{}
+	DefaultExclude  interface{}
+	DefaultTimeZone string
+	BlackoutFile    string
+	TimeKey         string
+
+	blackoutFile util.ReloadFile
+	blackout     []*timeWindow
+}
+
+type timeWindowConfig struct {
+	loc     *time.Location
+	include []*timeWindow
+	exclude []*timeWindow
+}
+
+func (slt *TimeWindow) getConfig(selectParam map[string]interface{}) (*timeWindowConfig, error) {
+	timeZone, err := util.GetStringParam(selectParam, "time_zone")
+	if err != nil {
+		timeZone = slt.DefaultTimeZone
+	}
+	loc, err := util.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf(`Load time zone "%s" error: %s`, timeZone, err)
+	}
+
+	includeParam, ok := selectParam["include"]
+	if !ok {
+		includeParam = slt.DefaultInclude
+	}
+	include, err := parseTimeWindows(includeParam, loc)
+	if err != nil {
+		return nil, fmt.Errorf("Parse include window error: %s", err)
+	}
+
+	excludeParam, ok := selectParam["exclude"]
+	if !ok {
+		excludeParam = slt.DefaultExclude
+	}
+	exclude, err := parseTimeWindows(excludeParam, loc)
+	if err != nil {
+		return nil, fmt.Errorf("Parse exclude window error: %s", err)
+	}
+
+	return &timeWindowConfig{
+		loc:     loc,
+		include: include,
+		exclude: exclude,
+	}, nil
+}
+
+// loadBlackoutFile will reload the blackout windows if the file changes,
+// the windows in the file are interpreted in the default time zone
+func (slt *TimeWindow) loadBlackoutFile() {
+	if slt.BlackoutFile == "" {
+		return
+	}
+
+	slt.blackoutFile.Path = slt.BlackoutFile
+	content, exists, changed, err := slt.blackoutFile.Load()
+	if err != nil {
+		slt.Errorf(`Load blackout file "%s" error: %s`, slt.BlackoutFile, err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if !exists {
+		slt.Debugf(`Blackout file "%s" does not exist`, slt.BlackoutFile)
+		slt.blackout = nil
+		return
+	}
+
+	var windowsParam interface{}
+	err = yaml.Unmarshal(content, &windowsParam)
+	if err != nil {
+		slt.Errorf(`Parse blackout file "%s" error: %s`, slt.BlackoutFile, err)
+		return
+	}
+
+	loc, err := util.LoadLocation(slt.DefaultTimeZone)
+	if err != nil {
+		slt.Errorf(`Load time zone "%s" error: %s`, slt.DefaultTimeZone, err)
+		return
+	}
+
+	blackout, err := parseTimeWindows(util.InterfaceMapToStringMap(windowsParam), loc)
+	if err != nil {
+		slt.Errorf(`Parse blackout file "%s" error: %s`, slt.BlackoutFile, err)
+		return
+	}
+
+	slt.Infof(`Blackout file "%s" loaded with %d windows`, slt.BlackoutFile, len(blackout))
+	slt.blackout = blackout
+}
+
+// activationTime gets the time from the trigger param,
+// or current time if not found
+func (slt *TimeWindow) activationTime(triggerParam map[string]interface{}, loc *time.Location) time.Time {
+	text, err := util.GetStringParam(triggerParam, slt.TimeKey)
+	if err == nil {
+		t, err := util.ParseTime(text, loc)
+		if err == nil {
+			return t.In(loc)
+		}
+		slt.Warnf(`Invalid activation time "%s", use current time`, text)
+	}
+	return time.Now().In(loc)
+}
+
+// ValidateSelectParam will check the windows in select param
+func (slt *TimeWindow) ValidateSelectParam(selectParam map[string]interface{}) error {
+	_, err := slt.getConfig(selectParam)
+	return err
+}
+
+// Select will pass when the activation time is in the windows
+func (slt *TimeWindow) Select(triggerParam, selectParam map[string]interface{}) bool {
+	cfg, err := slt.getConfig(selectParam)
+	if err != nil {
+		slt.Errorf("%s", err)
+		return false
+	}
+
+	slt.loadBlackoutFile()
+
+	t := slt.activationTime(triggerParam, cfg.loc)
+	timeText := t.Format(time.RFC3339)
+
+	if windowsContain(slt.blackout, t) {
+		slt.Debugf("Time in blackout: %s", timeText)
+		return false
+	}
+
+	if windowsContain(cfg.exclude, t) {
+		slt.Debugf("Time excluded: %s", timeText)
+		return false
+	}
+
+	if len(cfg.include) > 0 && !windowsContain(cfg.include, t) {
+		slt.Debugf("Time not included: %s", timeText)
+		return false
+	}
+
+	return true
+}
+
+func newSelectorTimeWindow(param map[string]interface{}) interface{} {
+	timeZone, _ := util.GetStringParam(param, "time_zone")
+	blackoutFile, _ := util.GetStringParam(param, "blackout_file")
+	timeKey, err := util.GetStringParam(param, "time_key")
+	if err != nil {
+		timeKey = "time"
+	}
+
+	return &TimeWindow{
+		DefaultInclude:  param["include"],
+		DefaultExclude:  param["exclude"],
+		DefaultTimeZone: timeZone,
+		BlackoutFile:    blackoutFile,
+		TimeKey:         timeKey,
+	}
+}
@@ -0,0 +1,150 @@
+package trigger
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// At is a trigger which will be active once at each specified time
+type At struct {
+	util.BaseLogger
+	Times      []string
+	TimeZone   string
+	StateFile  string
+	FireMissed bool
+
+	fired map[string]bool
+}
+
+type atState struct {
+	Fired []string `json:"fired"`
+}
+
+func (tgr *At) loadState() {
+	tgr.fired = make(map[string]bool)
+
+	if tgr.StateFile == "" {
+		return
+	}
+
+	var state atState
+	err := util.LoadStateFile(tgr.StateFile, &state)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			tgr.Errorf(`Load state file "%s" error: %s`, tgr.StateFile, err)
+		}
+		return
+	}
+
+	for _, t := range state.Fired {
+		tgr.fired[t] = true
+	}
+}
+
+func (tgr *At) saveState() {
+	if tgr.StateFile == "" {
+		return
+	}
+
+	state := atState{
+		Fired: make([]string, 0, len(tgr.fired)),
+	}
+	for t := range tgr.fired {
+		state.Fired = append(state.Fired, t)
+	}
+	sort.Strings(state.Fired)
+
+	err := util.SaveStateFile(tgr.StateFile, &state)
+	if err != nil {
+		tgr.Errorf(`Save state file "%s" error: %s`, tgr.StateFile, err)
+	}
+}
+
+func (tgr *At) fire(t time.Time, sendParam func(map[string]interface{})) {
+	key := t.Format(time.RFC3339)
+	tgr.fired[key] = true
+	tgr.saveState()
+
+	sendParam(map[string]interface{}{
+		"at":   key,
+		"time": time.Now().Format(time.RFC3339),
+	})
+}
+
+func (tgr *At) parseTimes() []time.Time {
+	loc, err := util.LoadLocation(tgr.TimeZone)
+	if err != nil {
+		tgr.Errorf(`Load time zone "%s" error: %s`, tgr.TimeZone, err)
+		return nil
+	}
+
+	times := make([]time.Time, 0, len(tgr.Times))
+	for _, text := range tgr.Times {
+		t, err := util.ParseTime(text, loc)
+		if err != nil {
+			tgr.Errorf("Parse time error: %s", err)
+			continue
+		}
+		times = append(times, t)
+	}
+
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	return times
+}
+
+// Run the At trigger
+func (tgr *At) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	tgr.loadState()
+
+	for _, t := range tgr.parseTimes() {
+		key := t.Format(time.RFC3339)
+		if tgr.fired[key] {
+			continue
+		}
+
+		now := time.Now()
+		if t.Before(now) {
+			if !tgr.FireMissed {
+				tgr.Warnf("Skip missed time: %s", key)
+				tgr.fired[key] = true
+				tgr.saveState()
+				continue
+			}
+			tgr.Infof("Fire missed time: %s", key)
+			tgr.fire(t, sendParam)
+			continue
+		}
+
+		timer := time.NewTimer(t.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			tgr.fire(t, sendParam)
+		}
+	}
+
+	tgr.Infof("All times have been fired")
+}
+
+func newTriggerAt(param map[string]interface{}) interface{} {
+	times, _ := util.GetStringSliceParam(param, "at")
+	timeZone, _ := util.GetStringParam(param, "time_zone")
+	stateFile, _ := util.GetStringParam(param, "state_file")
+	fireMissed, _ := util.GetBoolParam(param, "fire_missed")
+
+	return &At{
+		Times:      times,
+		TimeZone:   timeZone,
+		StateFile:  stateFile,
+		FireMissed: fireMissed,
+	}
+}
@@ -0,0 +1,145 @@
+package trigger
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// Calendar is a cron trigger which is only active on included dates
+// and never on excluded dates
+type Calendar struct {
+	Cron
+	TimeZone    string
+	IncludeDate []string
+	ExcludeDate []string
+	DateFile    string
+
+	dateFile    util.ReloadFile
+	fileInclude []util.DateRange
+	fileExclude []util.DateRange
+}
+
+type calendarDateFile struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func containsDate(ranges []util.DateRange, t time.Time) bool {
+	for _, r := range ranges {
+		if r.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tgr *Calendar) loadDateFile(loc *time.Location) {
+	if tgr.DateFile == "" {
+		return
+	}
+
+	content, exists, changed, err := tgr.dateFile.Load()
+	if err != nil {
+		tgr.Errorf(`Load date file "%s" error: %s`, tgr.DateFile, err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if !exists {
+		tgr.Warnf(`Date file "%s" does not exist`, tgr.DateFile)
+		tgr.fileInclude = nil
+		tgr.fileExclude = nil
+		return
+	}
+
+	var dates calendarDateFile
+	err = yaml.Unmarshal(content, &dates)
+	if err != nil {
+		tgr.Errorf(`Parse date file "%s" error: %s`, tgr.DateFile, err)
+		return
+	}
+
+	include, err := util.ParseDateRanges(dates.Include, loc)
+	if err != nil {
+		tgr.Errorf(`Parse include date in "%s" error: %s`, tgr.DateFile, err)
+		return
+	}
+	exclude, err := util.ParseDateRanges(dates.Exclude, loc)
+	if err != nil {
+		tgr.Errorf(`Parse exclude date in "%s" error: %s`, tgr.DateFile, err)
+		return
+	}
+
+	tgr.Infof(`Date file "%s" loaded`, tgr.DateFile)
+	tgr.fileInclude = include
+	tgr.fileExclude = exclude
+}
+
+// Run the Calendar trigger
+func (tgr *Calendar) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	loc, err := util.LoadLocation(tgr.TimeZone)
+	if err != nil {
+		tgr.Errorf(`Load time zone "%s" error: %s`, tgr.TimeZone, err)
+		return
+	}
+	tgr.Location = loc
+
+	include, err := util.ParseDateRanges(tgr.IncludeDate, loc)
+	if err != nil {
+		tgr.Errorf("Parse include date error: %s", err)
+		return
+	}
+	exclude, err := util.ParseDateRanges(tgr.ExcludeDate, loc)
+	if err != nil {
+		tgr.Errorf("Parse exclude date error: %s", err)
+		return
+	}
+
+	tgr.dateFile.Path = tgr.DateFile
+
+	tgr.Cron.Run(ctx, func(param map[string]interface{}) {
+		tgr.loadDateFile(loc)
+
+		now := time.Now().In(loc)
+
+		if containsDate(exclude, now) || containsDate(tgr.fileExclude, now) {
+			tgr.Debugf("Date excluded: %s", now.Format("2006-01-02"))
+			return
+		}
+
+		if len(include) > 0 || len(tgr.fileInclude) > 0 {
+			if !containsDate(include, now) && !containsDate(tgr.fileInclude, now) {
+				tgr.Debugf("Date not included: %s", now.Format("2006-01-02"))
+				return
+			}
+		}
+
+		param["date"] = now.Format("2006-01-02")
+		sendParam(param)
+	})
+}
+
+func newTriggerCalendar(param map[string]interface{}) interface{} {
+	spec, _ := util.GetStringParam(param, "cron")
+	withSeconds, _ := util.GetBoolParam(param, "with_seconds")
+	timeZone, _ := util.GetStringParam(param, "time_zone")
+	includeDate, _ := util.GetStringSliceParam(param, "include_date")
+	excludeDate, _ := util.GetStringSliceParam(param, "exclude_date")
+	dateFile, _ := util.GetStringParam(param, "date_file")
+
+	return &Calendar{
+		Cron: Cron{
+			Spec:        spec,
+			WithSeconds: withSeconds,
+		},
+		TimeZone:    timeZone,
+		IncludeDate: includeDate,
+		ExcludeDate: excludeDate,
+		DateFile:    dateFile,
+	}
+}
@@ -14,18 +14,21 @@ type Cron struct {
 	util.BaseLogger
 	Spec        string
 	WithSeconds bool
+	Location    *time.Location
 }
 
 // Run the Cron trigger
 func (tgr *Cron) Run(ctx context.Context, sendParam func(map[string]interface{})) {
 	cronChan := make(chan struct{})
 
-	var c *cron.Cron
+	var options []cron.Option
 	if tgr.WithSeconds {
-		c = cron.New(cron.WithSeconds())
-	} else {
-		c = cron.New()
+		options = append(options, cron.WithSeconds())
 	}
+	if tgr.Location != nil {
+		options = append(options, cron.WithLocation(tgr.Location))
+	}
+	c := cron.New(options...)
 
 	_, err := c.AddFunc(tgr.Spec, func() {
 		select {
@@ -0,0 +1,34 @@
+package trigger
+
+import (
+	"context"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// ExeBackgroundDone is a trigger which will be activated
+// when a background job of local executor finished
+type ExeBackgroundDone struct {
+	util.BaseLogger
+}
+
+// Run the ExeBackgroundDone trigger
+func (tgr *ExeBackgroundDone) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	queue := util.SubscribeBackgroundDone()
+	defer util.UnsubscribeBackgroundDone(queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-queue.Notify():
+			for _, param := range queue.Pop() {
+				sendParam(param)
+			}
+		}
+	}
+}
+
+func newTriggerExeBackgroundDone(param map[string]interface{}) interface{} {
+	return &ExeBackgroundDone{}
+}
@@ -0,0 +1,301 @@
+package trigger
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+const gitPollRemoteName = "herald-trigger-git-poll"
+
+// GitPoll is a trigger which fetches the git repository periodically
+// and will be active when watched branches or tags change
+type GitPoll struct {
+	util.BaseLogger
+	Interval       time.Duration
+	Repo           string
+	Username       string
+	Password       string
+	SSHKey         string
+	SSHKeyFile     string
+	SSHKeyPassword string
+	Branches       []string
+	TagPattern     string
+
+	git        util.ExeGit
+	tagFetched bool
+}
+
+// SetLogger will set logger for both trigger and git
+func (tgr *GitPoll) SetLogger(logger interface{}) {
+	tgr.BaseLogger.SetLogger(logger)
+	tgr.git.SetLogger(logger)
+}
+
+func (tgr *GitPoll) refSpecs() []string {
+	refSpecs := make([]string, 0, 2)
+	refSpecs = append(refSpecs, "+refs/heads/*:refs/remotes/"+gitPollRemoteName+"/heads/*")
+	if tgr.TagPattern != "" {
+		refSpecs = append(refSpecs, "+refs/tags/*:refs/remotes/"+gitPollRemoteName+"/tags/*")
+	}
+	return refSpecs
+}
+
+func (tgr *GitPoll) loadRefs(repo *git.Repository) (map[string]plumbing.Hash, error) {
+	refs := make(map[string]plumbing.Hash)
+
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	prefix := "refs/remotes/" + gitPollRemoteName + "/"
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		refs["refs/"+strings.TrimPrefix(name, prefix)] = ref.Hash()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+func (tgr *GitPoll) resolveCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	tag, err := repo.TagObject(hash)
+	if err == nil {
+		return tag.Commit()
+	}
+	return repo.CommitObject(hash)
+}
+
+func (tgr *GitPoll) changedFiles(oldCommit, newCommit *object.Commit) []interface{} {
+	files := make([]interface{}, 0)
+
+	oldTree, err := oldCommit.Tree()
+	if err != nil {
+		tgr.Errorf("Get tree of commit %s error: %s", oldCommit.Hash, err)
+		return files
+	}
+	newTree, err := newCommit.Tree()
+	if err != nil {
+		tgr.Errorf("Get tree of commit %s error: %s", newCommit.Hash, err)
+		return files
+	}
+
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		tgr.Errorf("Diff tree error: %s", err)
+		return files
+	}
+
+	for _, change := range changes {
+		if change.To.Name != "" {
+			files = append(files, change.To.Name)
+		} else {
+			files = append(files, change.From.Name)
+		}
+	}
+
+	return files
+}
+
+func (tgr *GitPoll) refParam(repo *git.Repository, url, ref, refType, name string, oldHash, newHash plumbing.Hash) map[string]interface{} {
+	param := map[string]interface{}{
+		"git_repo":   url,
+		"ref":        ref,
+		"ref_type":   refType,
+		"name":       name,
+		"old_commit": "",
+		"new_commit": "",
+		"files":      []interface{}{},
+	}
+
+	newCommit, err := tgr.resolveCommit(repo, newHash)
+	if err != nil {
+		tgr.Errorf(`Get commit for "%s" error: %s`, ref, err)
+		return param
+	}
+
+	param["new_commit"] = newCommit.Hash.String()
+	param["author"] = newCommit.Author.Name
+	param["author_email"] = newCommit.Author.Email
+	param["message"] = newCommit.Message
+	param["time"] = newCommit.Author.When.Format(time.RFC3339)
+
+	if oldHash.IsZero() {
+		return param
+	}
+
+	oldCommit, err := tgr.resolveCommit(repo, oldHash)
+	if err != nil {
+		tgr.Errorf(`Get old commit for "%s" error: %s`, ref, err)
+		return param
+	}
+
+	param["old_commit"] = oldCommit.Hash.String()
+	param["files"] = tgr.changedFiles(oldCommit, newCommit)
+
+	return param
+}
+
+func (tgr *GitPoll) poll(sendParam func(map[string]interface{})) {
+	repo, err := tgr.git.OpenRepo(tgr.Repo)
+	if err != nil {
+		tgr.Errorf("Open git repository error: %s", err)
+		return
+	}
+
+	oldRefs, err := tgr.loadRefs(repo)
+	if err != nil {
+		tgr.Errorf("Load references error: %s", err)
+		return
+	}
+
+	repo, url, err := tgr.git.FetchRepo(tgr.Repo, tgr.Username, tgr.Password, tgr.SSHKey, tgr.SSHKeyFile, tgr.SSHKeyPassword, tgr.refSpecs())
+	if err != nil {
+		tgr.Errorf("Fetch git repository error: %s", err)
+		return
+	}
+
+	newRefs, err := tgr.loadRefs(repo)
+	if err != nil {
+		tgr.Errorf("Load references error: %s", err)
+		return
+	}
+
+	// The first fetch only records the current state
+	if len(oldRefs) == 0 {
+		tgr.Debugf("Initial fetch of repository: %s", url)
+		tgr.tagFetched = true
+		return
+	}
+
+	for _, branch := range tgr.Branches {
+		ref := "refs/heads/" + branch
+		newHash, ok := newRefs[ref]
+		if !ok || newHash == oldRefs[ref] {
+			continue
+		}
+		tgr.Infof(`Branch "%s" moved to %s`, branch, newHash)
+		sendParam(tgr.refParam(repo, url, ref, "branch", branch, oldRefs[ref], newHash))
+	}
+
+	if tgr.TagPattern == "" {
+		return
+	}
+
+	// Tags may be just added to the watch list, so only record them
+	if !tgr.tagFetched {
+		tgr.tagFetched = true
+		oldTagFound := false
+		for ref := range oldRefs {
+			if strings.HasPrefix(ref, "refs/tags/") {
+				oldTagFound = true
+				break
+			}
+		}
+		if !oldTagFound {
+			return
+		}
+	}
+
+	for ref, newHash := range newRefs {
+		if !strings.HasPrefix(ref, "refs/tags/") || newHash == oldRefs[ref] {
+			continue
+		}
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		matched, err := path.Match(tgr.TagPattern, tag)
+		if err != nil {
+			tgr.Errorf(`Invalid tag pattern "%s": %s`, tgr.TagPattern, err)
+			return
+		}
+		if !matched {
+			continue
+		}
+		tgr.Infof(`Tag "%s" found at %s`, tag, newHash)
+		sendParam(tgr.refParam(repo, url, ref, "tag", tag, oldRefs[ref], newHash))
+	}
+}
+
+// Run the GitPoll trigger
+func (tgr *GitPoll) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	if tgr.git.WorkDir == "" {
+		tgr.Errorf("WorkDir must be specified")
+		return
+	}
+	if tgr.Repo == "" {
+		tgr.Errorf("Git repository must be specified")
+		return
+	}
+
+	ticker := time.NewTicker(tgr.Interval)
+	defer ticker.Stop()
+
+	tgr.poll(sendParam)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tgr.poll(sendParam)
+		}
+	}
+}
+
+func newTriggerGitPoll(param map[string]interface{}) interface{} {
+	interval, _ := util.GetIntParam(param, "interval")
+	if interval <= 0 {
+		interval = 60
+	}
+
+	workDir, _ := util.GetStringParam(param, "work_dir")
+
+	fetchTimeout, err := util.GetIntParam(param, "fetch_timeout")
+	if err != nil || fetchTimeout <= 0 {
+		fetchTimeout = interval
+	}
+
+	repo, _ := util.GetStringParam(param, "git_repo")
+	username, _ := util.GetStringParam(param, "git_username")
+	password, _ := util.GetStringParam(param, "git_password")
+	sshKey, _ := util.GetStringParam(param, "git_ssh_key")
+	sshKeyFile, _ := util.GetStringParam(param, "git_ssh_key_file")
+	sshKeyPassword, _ := util.GetStringParam(param, "git_ssh_key_password")
+	branches, _ := util.GetStringSliceParam(param, "git_branch")
+	tagPattern, _ := util.GetStringParam(param, "tag_pattern")
+
+	if len(branches) == 0 {
+		branches = []string{"master"}
+	}
+
+	return &GitPoll{
+		Interval:       time.Duration(interval) * time.Second,
+		Repo:           repo,
+		Username:       username,
+		Password:       password,
+		SSHKey:         sshKey,
+		SSHKeyFile:     sshKeyFile,
+		SSHKeyPassword: sshKeyPassword,
+		Branches:       branches,
+		TagPattern:     tagPattern,
+		git: util.ExeGit{
+			WorkDir:      workDir,
+			FetchTimeout: time.Duration(fetchTimeout) * time.Second,
+			RepoDirName:  "gitpoll",
+		},
+	}
+}
@@ -0,0 +1,297 @@
+package trigger
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+const defaultHTTPPollMaxBodySize = 10 * 1024 * 1024
+
+// HTTPPoll is a trigger which requests the url periodically
+// and will be active when the response changes
+type HTTPPoll struct {
+	util.BaseLogger
+	Interval           time.Duration
+	URL                string
+	Header             map[string]string
+	Username           string
+	Password           string
+	BearerToken        string
+	Timeout            time.Duration
+	InsecureSkipVerify bool
+	CAFile             string
+	MaxBodySize        int64
+	OnStatusChange     bool
+	OnBodyChange       bool
+	OnJSONMatch        bool
+	OnError            bool
+	JSONKey            string
+	JSONValue          interface{}
+
+	client         *http.Client
+	lastStatusCode int
+	lastBodySum    string
+	lastJSONMatch  bool
+	lastError      bool
+	lastValid      bool
+}
+
+func (tgr *HTTPPoll) createClient() error {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: tgr.InsecureSkipVerify,
+	}
+
+	if tgr.CAFile != "" {
+		caCert, err := ioutil.ReadFile(tgr.CAFile)
+		if err != nil {
+			return err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf(`No valid certificate found in "%s"`, tgr.CAFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	tgr.client = &http.Client{
+		Timeout: tgr.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return nil
+}
+
+func (tgr *HTTPPoll) request() (int, string, map[string]interface{}, []byte, error) {
+	req, err := http.NewRequest("GET", tgr.URL, nil)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+
+	for k, v := range tgr.Header {
+		req.Header.Set(k, v)
+	}
+	if tgr.Username != "" || tgr.Password != "" {
+		req.SetBasicAuth(tgr.Username, tgr.Password)
+	}
+	if tgr.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+tgr.BearerToken)
+	}
+
+	resp, err := tgr.client.Do(req)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, tgr.MaxBodySize+1))
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	if int64(len(body)) > tgr.MaxBodySize {
+		return 0, "", nil, nil, fmt.Errorf("Response body exceeds %d bytes", tgr.MaxBodySize)
+	}
+
+	header := make(map[string]interface{})
+	for k, v := range resp.Header {
+		header[k] = strings.Join(v, ", ")
+	}
+
+	return resp.StatusCode, resp.Status, header, body, nil
+}
+
+func (tgr *HTTPPoll) matchJSON(body interface{}) bool {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	foundValue, err := util.GetNestedMapValue(bodyMap, tgr.JSONKey)
+	if err != nil {
+		return false
+	}
+
+	if tgr.JSONValue == nil {
+		return true
+	}
+
+	return util.ValueEqual(foundValue, tgr.JSONValue)
+}
+
+func (tgr *HTTPPoll) poll(sendParam func(map[string]interface{})) {
+	param := map[string]interface{}{
+		"url":  tgr.URL,
+		"time": time.Now().Format(time.RFC3339),
+	}
+
+	statusCode, status, header, body, err := tgr.request()
+	if err != nil {
+		tgr.Warnf("Request error: %s", err)
+		// keep the previous state so that the recovery is not regarded as a change
+		lastError := tgr.lastError
+		tgr.lastError = true
+		if !tgr.OnError || lastError {
+			return
+		}
+		param["error"] = err.Error()
+		param["reason"] = []interface{}{"error"}
+		sendParam(param)
+		return
+	}
+	tgr.lastError = false
+
+	bodySum := sha256.Sum256(body)
+	bodySumString := hex.EncodeToString(bodySum[:])
+
+	var bodyParsed interface{}
+	err = json.Unmarshal(body, &bodyParsed)
+	if err != nil {
+		bodyParsed = string(body)
+	}
+
+	param["status_code"] = statusCode
+	param["status"] = status
+	param["header"] = header
+	param["body"] = bodyParsed
+	param["body_sha256"] = bodySumString
+
+	var reason []interface{}
+	if tgr.lastValid {
+		if tgr.OnStatusChange && statusCode != tgr.lastStatusCode {
+			reason = append(reason, "status_change")
+		}
+		if tgr.OnBodyChange && bodySumString != tgr.lastBodySum {
+			reason = append(reason, "body_change")
+		}
+		param["previous_status_code"] = tgr.lastStatusCode
+	}
+	jsonMatch := tgr.OnJSONMatch && tgr.matchJSON(bodyParsed)
+	if jsonMatch && tgr.lastValid && !tgr.lastJSONMatch {
+		reason = append(reason, "json_match")
+	}
+
+	tgr.lastStatusCode = statusCode
+	tgr.lastBodySum = bodySumString
+	tgr.lastJSONMatch = jsonMatch
+	tgr.lastValid = true
+
+	if len(reason) == 0 {
+		tgr.Debugf("Response not changed: status(%d)", statusCode)
+		return
+	}
+
+	param["reason"] = reason
+	sendParam(param)
+}
+
+// Run the HTTPPoll trigger
+func (tgr *HTTPPoll) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	if tgr.URL == "" {
+		tgr.Errorf("URL must be specified")
+		return
+	}
+
+	err := tgr.createClient()
+	if err != nil {
+		tgr.Errorf("Create http client error: %s", err)
+		return
+	}
+
+	ticker := time.NewTicker(tgr.Interval)
+	defer ticker.Stop()
+
+	tgr.poll(sendParam)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tgr.poll(sendParam)
+		}
+	}
+}
+
+func newTriggerHTTPPoll(param map[string]interface{}) interface{} {
+	interval, _ := util.GetIntParam(param, "interval")
+	if interval <= 0 {
+		interval = 60
+	}
+
+	timeout, _ := util.GetIntParam(param, "timeout")
+	if timeout <= 0 {
+		timeout = 30
+	}
+
+	url, _ := util.GetStringParam(param, "url")
+	header, _ := util.GetMapParam(param, "header")
+	username, _ := util.GetStringParam(param, "username")
+	password, _ := util.GetStringParam(param, "password")
+	bearerToken, _ := util.GetStringParam(param, "bearer_token")
+	insecureSkipVerify, _ := util.GetBoolParam(param, "insecure_skip_verify")
+	caFile, _ := util.GetStringParam(param, "ca_file")
+	jsonKey, _ := util.GetStringParam(param, "json_key")
+
+	maxBodySize, err := util.ParseSize(param["max_body_size"])
+	if err != nil || maxBodySize <= 0 {
+		maxBodySize = defaultHTTPPollMaxBodySize
+	}
+
+	fireOn, err := util.GetStringSliceParam(param, "fire_on")
+	if err != nil {
+		fireOn = []string{"status_change"}
+	}
+
+	headerMap := make(map[string]string)
+	for k, v := range header {
+		value, ok := v.(string)
+		if !ok {
+			continue
+		}
+		headerMap[k] = value
+	}
+
+	tgr := &HTTPPoll{
+		Interval:           time.Duration(interval) * time.Second,
+		URL:                url,
+		Header:             headerMap,
+		Username:           username,
+		Password:           password,
+		BearerToken:        bearerToken,
+		Timeout:            time.Duration(timeout) * time.Second,
+		InsecureSkipVerify: insecureSkipVerify,
+		CAFile:             caFile,
+		MaxBodySize:        int64(maxBodySize),
+		JSONKey:            jsonKey,
+		JSONValue:          param["json_value"],
+	}
+
+	for _, f := range fireOn {
+		switch f {
+		case "status_change":
+			tgr.OnStatusChange = true
+		case "body_change":
+			tgr.OnBodyChange = true
+		case "json_match":
+			tgr.OnJSONMatch = tgr.JSONKey != ""
+		case "error":
+			tgr.OnError = true
+		}
+	}
+
+	return tgr
+}
@@ -0,0 +1,206 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// PollCommand is a trigger which runs a command periodically
+// and will be active when the result changes
+type PollCommand struct {
+	util.BaseLogger
+	Interval         time.Duration
+	Cmd              string
+	Arg              []string
+	Env              []string
+	WorkDir          string
+	Timeout          time.Duration
+	OnOutputChange   bool
+	OnExitCodeChange bool
+	OnExitCode       bool
+	ExitCodes        []string
+
+	lastOutput   string
+	lastExitCode int
+	lastValid    bool
+}
+
+func parseOutput(output string) interface{} {
+	var outputJSON interface{}
+	err := json.Unmarshal([]byte(output), &outputJSON)
+	if err != nil {
+		return output
+	}
+	return outputJSON
+}
+
+// matchExitCode checks the exit code with conditions like "1" or "!0"
+func (tgr *PollCommand) matchExitCode(exitCode int) bool {
+	for _, cond := range tgr.ExitCodes {
+		negative := strings.HasPrefix(cond, "!")
+		code, err := strconv.Atoi(strings.TrimPrefix(cond, "!"))
+		if err != nil {
+			continue
+		}
+		if (code == exitCode) != negative {
+			return true
+		}
+	}
+	return false
+}
+
+func (tgr *PollCommand) poll(sendParam func(map[string]interface{})) {
+	fullCommand := []string{tgr.Cmd}
+	fullCommand = append(fullCommand, tgr.Arg...)
+
+	command := &util.Command{
+		Args:    fullCommand,
+		Dir:     tgr.WorkDir,
+		Env:     tgr.Env,
+		Timeout: tgr.Timeout,
+	}
+	result, err := command.Run()
+	if err != nil {
+		tgr.Errorf("Run poll command error: %s", err)
+		return
+	}
+	if result.TimedOut {
+		tgr.Errorf("Poll command timed out after %s", tgr.Timeout)
+		return
+	}
+	if result.Canceled {
+		return
+	}
+
+	stdout := result.Stdout
+	exitCode := result.ExitCode
+
+	var reason []interface{}
+	if tgr.lastValid {
+		if tgr.OnOutputChange && stdout != tgr.lastOutput {
+			reason = append(reason, "output_change")
+		}
+		if tgr.OnExitCodeChange && exitCode != tgr.lastExitCode {
+			reason = append(reason, "exit_code_change")
+		}
+	}
+	if tgr.OnExitCode && tgr.matchExitCode(exitCode) {
+		reason = append(reason, "exit_code")
+	}
+
+	if len(reason) > 0 {
+		param := map[string]interface{}{
+			"cmd":       tgr.Cmd,
+			"output":    parseOutput(stdout),
+			"exit_code": exitCode,
+			"reason":    reason,
+			"time":      time.Now().Format(time.RFC3339),
+		}
+		if tgr.lastValid {
+			param["previous_output"] = parseOutput(tgr.lastOutput)
+			param["previous_exit_code"] = tgr.lastExitCode
+		}
+		sendParam(param)
+	} else {
+		tgr.Debugf("Poll command result not changed: exit(%d)", exitCode)
+	}
+
+	tgr.lastOutput = stdout
+	tgr.lastExitCode = exitCode
+	tgr.lastValid = true
+}
+
+// Run the PollCommand trigger
+func (tgr *PollCommand) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	if tgr.Cmd == "" {
+		tgr.Errorf("Could not poll empty command")
+		return
+	}
+
+	ticker := time.NewTicker(tgr.Interval)
+	defer ticker.Stop()
+
+	tgr.poll(sendParam)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tgr.poll(sendParam)
+		}
+	}
+}
+
+func newTriggerPollCommand(param map[string]interface{}) interface{} {
+	interval, _ := util.GetIntParam(param, "interval")
+	if interval <= 0 {
+		interval = 60
+	}
+
+	cmd, _ := util.GetStringParam(param, "cmd")
+	arg, _ := util.GetStringSliceParam(param, "arg")
+	env, _ := util.GetMapParam(param, "env")
+	workDir, _ := util.GetStringParam(param, "work_dir")
+
+	timeout, err := util.GetIntParam(param, "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = interval
+	}
+
+	var envList []string
+	for k, v := range env {
+		value, ok := v.(string)
+		if !ok {
+			continue
+		}
+		envList = append(envList, k+"="+value)
+	}
+
+	fireOn, err := util.GetStringSliceParam(param, "fire_on")
+	if err != nil {
+		fireOn = []string{"output_change"}
+	}
+
+	tgr := &PollCommand{
+		Interval: time.Duration(interval) * time.Second,
+		Cmd:      cmd,
+		Arg:      arg,
+		Env:      envList,
+		WorkDir:  workDir,
+		Timeout:  time.Duration(timeout) * time.Second,
+	}
+
+	for _, f := range fireOn {
+		switch f {
+		case "output_change":
+			tgr.OnOutputChange = true
+		case "exit_code_change":
+			tgr.OnExitCodeChange = true
+		case "exit_code":
+			tgr.OnExitCode = true
+		}
+	}
+
+	exitCodes, ok := param["exit_code"].([]interface{})
+	if !ok {
+		exitCodes = []interface{}{param["exit_code"]}
+	}
+	for _, code := range exitCodes {
+		if code == nil {
+			continue
+		}
+		tgr.ExitCodes = append(tgr.ExitCodes, fmt.Sprint(code))
+	}
+	if tgr.OnExitCode && len(tgr.ExitCodes) == 0 {
+		tgr.ExitCodes = []string{"!0"}
+	}
+
+	return tgr
+}
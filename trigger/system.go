@@ -0,0 +1,223 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/heraldgo/heraldd/util"
+)
+
+// SystemRule is a threshold rule for a system metric,
+// or for an expression over the metrics
+type SystemRule struct {
+	Name       string
+	Metric     string
+	Expr       *util.Expr
+	Above      bool
+	Threshold  float64
+	Hysteresis float64
+
+	active bool
+}
+
+// source is the metric or the expression text of the rule
+func (rule *SystemRule) source() string {
+	if rule.Expr != nil {
+		return rule.Expr.String()
+	}
+	return rule.Metric
+}
+
+func (rule *SystemRule) value(metrics map[string]interface{}) (float64, error) {
+	if rule.Expr != nil {
+		return rule.Expr.EvalNumber(metrics)
+	}
+
+	metricValue, err := util.GetNestedMapValue(metrics, rule.Metric)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := util.ToFloat(metricValue)
+	if !ok {
+		return 0, errors.New("Metric is not a number")
+	}
+	return value, nil
+}
+
+// check returns whether the state of the rule changes
+func (rule *SystemRule) check(value float64) bool {
+	var active bool
+	if rule.Above {
+		if rule.active {
+			active = value > rule.Threshold-rule.Hysteresis
+		} else {
+			active = value > rule.Threshold
+		}
+	} else {
+		if rule.active {
+			active = value < rule.Threshold+rule.Hysteresis
+		} else {
+			active = value < rule.Threshold
+		}
+	}
+
+	changed := active != rule.active
+	rule.active = active
+	return changed
+}
+
+// System is a trigger which samples system metrics periodically
+// and will be active when the metrics cross the thresholds
+type System struct {
+	util.BaseLogger
+	Interval    time.Duration
+	Mounts      map[string]string
+	Rules       []*SystemRule
+	FireOnClear bool
+
+	// InvalidRules are the rules which could not be parsed
+	InvalidRules map[string]error
+}
+
+func (tgr *System) poll(sendParam func(map[string]interface{})) {
+	metrics, err := util.CollectSystemMetrics(tgr.Mounts)
+	if err != nil {
+		tgr.Errorf("Collect system metrics error: %s", err)
+		return
+	}
+
+	for _, rule := range tgr.Rules {
+		value, err := rule.value(metrics)
+		if err != nil {
+			tgr.Errorf(`Value "%s" for rule "%s" error: %s`, rule.source(), rule.Name, err)
+			continue
+		}
+
+		if !rule.check(value) {
+			continue
+		}
+
+		state := "clear"
+		if rule.active {
+			state = "alert"
+		}
+
+		tgr.Infof(`Rule "%s" changed to "%s": %s = %v`, rule.Name, state, rule.source(), value)
+
+		if !rule.active && !tgr.FireOnClear {
+			continue
+		}
+
+		param := map[string]interface{}{
+			"rule":      rule.Name,
+			"state":     state,
+			"value":     value,
+			"threshold": rule.Threshold,
+			"metrics":   util.DeepCopyMapParam(metrics),
+			"time":      time.Now().Format(time.RFC3339),
+		}
+		if rule.Expr != nil {
+			param["expr"] = rule.Expr.String()
+		} else {
+			param["metric"] = rule.Metric
+		}
+		sendParam(param)
+	}
+}
+
+// Run the System trigger
+func (tgr *System) Run(ctx context.Context, sendParam func(map[string]interface{})) {
+	for name, err := range tgr.InvalidRules {
+		tgr.Errorf(`Rule "%s" is ignored: %s`, name, err)
+	}
+
+	ticker := time.NewTicker(tgr.Interval)
+	defer ticker.Stop()
+
+	tgr.poll(sendParam)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tgr.poll(sendParam)
+		}
+	}
+}
+
+func newTriggerSystem(param map[string]interface{}) interface{} {
+	interval, _ := util.GetIntParam(param, "interval")
+	if interval <= 0 {
+		interval = 60
+	}
+
+	fireOnClear, _ := util.GetBoolParam(param, "fire_on_clear")
+
+	mounts := make(map[string]string)
+	mountParam, err := util.GetMapParam(param, "mount")
+	if err != nil {
+		mounts["root"] = "/"
+	}
+	for name, v := range mountParam {
+		path, ok := v.(string)
+		if !ok {
+			continue
+		}
+		mounts[name] = path
+	}
+
+	var rules []*SystemRule
+	invalidRules := make(map[string]error)
+	ruleParam, _ := util.GetMapParam(param, "rule")
+	for name := range ruleParam {
+		ruleMap, err := util.GetMapParam(ruleParam, name)
+		if err != nil {
+			continue
+		}
+
+		metric, _ := util.GetStringParam(ruleMap, "metric")
+		hysteresis, _ := util.GetNumberParam(ruleMap, "hysteresis")
+		rule := &SystemRule{
+			Name:       name,
+			Metric:     metric,
+			Hysteresis: hysteresis,
+		}
+
+		exprText, err := util.GetStringParam(ruleMap, "expr")
+		if err == nil {
+			rule.Expr, err = util.CompileExpr(exprText)
+			if err != nil {
+				invalidRules[name] = err
+				continue
+			}
+		} else if metric == "" {
+			invalidRules[name] = errors.New("Neither metric nor expr is specified")
+			continue
+		}
+
+		above, err := util.GetNumberParam(ruleMap, "above")
+		if err == nil {
+			rule.Above = true
+			rule.Threshold = above
+		} else {
+			below, err := util.GetNumberParam(ruleMap, "below")
+			if err != nil {
+				invalidRules[name] = errors.New("Neither above nor below is specified")
+				continue
+			}
+			rule.Threshold = below
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return &System{
+		Interval:     time.Duration(interval) * time.Second,
+		Mounts:       mounts,
+		Rules:        rules,
+		FireOnClear:  fireOnClear,
+		InvalidRules: invalidRules,
+	}
+}
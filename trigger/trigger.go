@@ -5,9 +5,17 @@ import (
 )
 
 var triggers = map[string]func(map[string]interface{}) interface{}{
-	"tick": newTriggerTick,
-	"cron": newTriggerCron,
-	"http": newTriggerHTTP,
+	"tick":         newTriggerTick,
+	"cron":         newTriggerCron,
+	"http":         newTriggerHTTP,
+	"at":           newTriggerAt,
+	"calendar":     newTriggerCalendar,
+	"poll_command": newTriggerPollCommand,
+	"git_poll":     newTriggerGitPoll,
+	"http_poll":    newTriggerHTTPPoll,
+	"system":       newTriggerSystem,
+
+	"exe_background_done": newTriggerExeBackgroundDone,
 }
 
 // CreateTrigger create a new trigger
@@ -0,0 +1,264 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const backgroundFinishedKeep = 20
+
+var backgroundWaitGroup sync.WaitGroup
+
+// BackgroundDoneQueue receives the params of the finished background jobs
+type BackgroundDoneQueue struct {
+	mutex  sync.Mutex
+	params []map[string]interface{}
+	notify chan struct{}
+}
+
+// Notify returns the channel which is notified
+// when there are finished background jobs
+func (q *BackgroundDoneQueue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// Pop returns and clears the params of the finished background jobs
+func (q *BackgroundDoneQueue) Pop() []map[string]interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	params := q.params
+	q.params = nil
+	return params
+}
+
+func (q *BackgroundDoneQueue) push(param map[string]interface{}) {
+	q.mutex.Lock()
+	q.params = append(q.params, param)
+	q.mutex.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// backgroundDoneQueues are the subscribed queues,
+// each of them receives all the finished background jobs
+var backgroundDoneQueues = struct {
+	mutex  sync.Mutex
+	queues map[*BackgroundDoneQueue]bool
+}{
+	queues: make(map[*BackgroundDoneQueue]bool),
+}
+
+// SubscribeBackgroundDone creates a queue for the finished background jobs
+func SubscribeBackgroundDone() *BackgroundDoneQueue {
+	q := &BackgroundDoneQueue{
+		notify: make(chan struct{}, 1),
+	}
+
+	backgroundDoneQueues.mutex.Lock()
+	backgroundDoneQueues.queues[q] = true
+	backgroundDoneQueues.mutex.Unlock()
+	return q
+}
+
+// UnsubscribeBackgroundDone stops the queue from receiving
+func UnsubscribeBackgroundDone(q *BackgroundDoneQueue) {
+	backgroundDoneQueues.mutex.Lock()
+	delete(backgroundDoneQueues.queues, q)
+	backgroundDoneQueues.mutex.Unlock()
+}
+
+// pushBackgroundDone copies the param of the finished background job
+// into all the subscribed queues
+func pushBackgroundDone(param map[string]interface{}) {
+	backgroundDoneQueues.mutex.Lock()
+	defer backgroundDoneQueues.mutex.Unlock()
+
+	for q := range backgroundDoneQueues.queues {
+		q.push(DeepCopyMapParam(param))
+	}
+}
+
+// WaitBackgroundJobs waits for all background jobs to exit,
+// they should be terminated by CancelCommands first
+func WaitBackgroundJobs() {
+	backgroundWaitGroup.Wait()
+}
+
+type backgroundJob struct {
+	JobID     string   `json:"job_id"`
+	Router    string   `json:"router"`
+	Task      string   `json:"task"`
+	Executor  string   `json:"executor"`
+	Command   []string `json:"command"`
+	Pid       int      `json:"pid,omitempty"`
+	Status    string   `json:"status"`
+	StartTime string   `json:"start_time"`
+	EndTime   string   `json:"end_time,omitempty"`
+	ExitCode  int      `json:"exit_code"`
+	Error     string   `json:"error,omitempty"`
+
+	log loggerI
+}
+
+// backgroundTracker keeps the status of background jobs in the status file
+type backgroundTracker struct {
+	statusFile string
+
+	mutex    sync.Mutex
+	running  map[string]*backgroundJob
+	finished []*backgroundJob
+}
+
+// backgroundTrackers keeps one tracker for each status file,
+// so the executors sharing the work directory do not overwrite each other
+var backgroundTrackers = struct {
+	mutex    sync.Mutex
+	trackers map[string]*backgroundTracker
+}{
+	trackers: make(map[string]*backgroundTracker),
+}
+
+// getBackgroundTracker returns the tracker of the status file
+func getBackgroundTracker(statusFile string) *backgroundTracker {
+	statusFile = filepath.Clean(statusFile)
+
+	backgroundTrackers.mutex.Lock()
+	defer backgroundTrackers.mutex.Unlock()
+
+	t, ok := backgroundTrackers.trackers[statusFile]
+	if !ok {
+		t = &backgroundTracker{
+			statusFile: statusFile,
+		}
+		backgroundTrackers.trackers[statusFile] = t
+	}
+	return t
+}
+
+func (t *backgroundTracker) writeStatus(log loggerI) {
+	running := make([]*backgroundJob, 0, len(t.running))
+	for _, job := range t.running {
+		running = append(running, job)
+	}
+
+	content, err := json.MarshalIndent(map[string]interface{}{
+		"running":  running,
+		"finished": t.finished,
+	}, "", "  ")
+	if err != nil {
+		log.Errorf("Generate background job status error: %s", err)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(t.statusFile), 0755)
+	if err == nil {
+		tempFile := t.statusFile + ".tmp"
+		err = ioutil.WriteFile(tempFile, content, 0600)
+		if err == nil {
+			err = os.Rename(tempFile, t.statusFile)
+		}
+	}
+	if err != nil {
+		log.Errorf(`Write background job status "%s" error: %s`, t.statusFile, err)
+	}
+}
+
+func (t *backgroundTracker) start(job *backgroundJob) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.running == nil {
+		t.running = make(map[string]*backgroundJob)
+	}
+	job.Status = "running"
+	job.StartTime = time.Now().Format(time.RFC3339Nano)
+	t.running[job.JobID] = job
+	t.writeStatus(job.log)
+}
+
+func (t *backgroundTracker) setPid(job *backgroundJob, pid int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	job.Pid = pid
+	t.writeStatus(job.log)
+}
+
+func (t *backgroundTracker) finish(job *backgroundJob, exitCode int, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.running, job.JobID)
+	job.Status = "finished"
+	job.EndTime = time.Now().Format(time.RFC3339Nano)
+	job.ExitCode = exitCode
+	if err != nil {
+		job.Error = err.Error()
+	}
+
+	t.finished = append(t.finished, job)
+	if len(t.finished) > backgroundFinishedKeep {
+		t.finished = t.finished[len(t.finished)-backgroundFinishedKeep:]
+	}
+	t.writeStatus(job.log)
+}
+
+// runBackground runs the command in background and tracks its status,
+// the finished event is sent with the execution param and result
+func (t *backgroundTracker) runBackground(log loggerI, param map[string]interface{}, command *Command, getResult func(*CommandResult) map[string]interface{}, cleanup func()) {
+	job := &backgroundJob{
+		Command: command.Args,
+		log:     log,
+	}
+	job.JobID, _ = GetStringParam(param, "job_id")
+	job.Router, _ = GetStringParam(param, "router")
+	job.Task, _ = GetStringParam(param, "task")
+	job.Executor, _ = GetStringParam(param, "executor")
+
+	t.start(job)
+	command.Started = func(pid int) {
+		t.setPid(job, pid)
+	}
+
+	backgroundWaitGroup.Add(1)
+	go func() {
+		defer backgroundWaitGroup.Done()
+		defer cleanup()
+
+		doneParam := DeepCopyMapParam(param)
+
+		cmdResult, err := command.Run()
+		if err != nil {
+			log.Errorf(`Background job "%s" error: %s`, job.JobID, err)
+			t.finish(job, -1, err)
+			doneParam["result"] = map[string]interface{}{}
+			doneParam["success"] = false
+			doneParam["error"] = err.Error()
+			pushBackgroundDone(doneParam)
+			return
+		}
+
+		result := getResult(cmdResult)
+		err = CheckCommandResult(result)
+		t.finish(job, cmdResult.ExitCode, err)
+
+		doneParam["result"] = result
+		if err != nil {
+			log.Errorf(`Background job "%s" finished with error: %s`, job.JobID, err)
+			doneParam["success"] = false
+			doneParam["error"] = err.Error()
+		} else {
+			log.Infof(`Background job "%s" finished successfully`, job.JobID)
+			doneParam["success"] = true
+		}
+		pushBackgroundDone(doneParam)
+	}()
+}
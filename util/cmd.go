@@ -2,9 +2,15 @@ package util
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // RunCmd will open the sub process
@@ -49,3 +55,338 @@ func RunCmd(args []string, cwd string, env []string, background bool, stdout, st
 
 	return exitCode, nil
 }
+
+// The executable written just now, like the temporary script, could be
+// still open in the processes forked at the same time, so exec fails with
+// ETXTBSY until they exec (golang/go#22315), just retry for a while
+const (
+	textBusyRetries    = 10
+	textBusyRetryDelay = 50 * time.Millisecond
+)
+
+func isTextBusy(err error) bool {
+	return errors.Is(err, syscall.ETXTBSY)
+}
+
+// DefaultKillGrace is the time to wait after SIGTERM before killing the process group
+const DefaultKillGrace = 10 * time.Second
+
+var commandCtx, cancelCommands = context.WithCancel(context.Background())
+
+// CancelCommands terminates all the running commands started by Command,
+// and the commands started later will be canceled immediately
+func CancelCommands() {
+	cancelCommands()
+}
+
+// CommandContext returns the context which is canceled by CancelCommands,
+// for the long running processes not started by Command
+func CommandContext() context.Context {
+	return commandCtx
+}
+
+// limitBuffer keeps at most limit bytes and counts the dropped ones,
+// no limit if limit is not positive
+type limitBuffer struct {
+	buf     bytes.Buffer
+	limit   int64
+	dropped int64
+}
+
+func (b *limitBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit > 0 {
+		left := b.limit - int64(b.buf.Len())
+		if left < 0 {
+			left = 0
+		}
+		if int64(n) > left {
+			b.dropped += int64(n) - left
+			p = p[:left]
+		}
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String returns the content with a marker if truncated
+func (b *limitBuffer) String() string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n... [truncated %d bytes]", b.buf.String(), b.dropped)
+}
+
+// tailBuffer keeps only the last lines lines and at most limit bytes,
+// and counts the dropped ones, no byte limit if limit is not positive
+type tailBuffer struct {
+	lines     int
+	limit     int64
+	buf       []byte
+	newlines  int
+	dropped   int
+	truncated int64
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	b.newlines += bytes.Count(p, []byte("\n"))
+
+	count := b.newlines
+	if len(b.buf) > 0 && b.buf[len(b.buf)-1] != '\n' {
+		count++
+	}
+	for ; count > b.lines; count-- {
+		i := bytes.IndexByte(b.buf, '\n')
+		b.buf = b.buf[i+1:]
+		b.newlines--
+		b.dropped++
+		b.truncated = 0
+	}
+
+	if b.limit > 0 && int64(len(b.buf)) > b.limit {
+		cut := len(b.buf) - int(b.limit)
+		lines := bytes.Count(b.buf[:cut], []byte("\n"))
+		if lines > 0 {
+			b.truncated = 0
+		}
+		if i := bytes.IndexByte(b.buf[cut:], '\n'); i >= 0 && i+1 < len(b.buf)-cut {
+			// Drop the whole line which exceeds the limit
+			cut += i + 1
+			lines++
+			b.truncated = 0
+		} else {
+			// Only the first line is left, which is truncated from the beginning
+			b.truncated += int64(cut - (bytes.LastIndexByte(b.buf[:cut], '\n') + 1))
+		}
+		b.buf = b.buf[cut:]
+		b.newlines -= lines
+		b.dropped += lines
+	}
+
+	return len(p), nil
+}
+
+// String returns the last lines with a marker if some are dropped
+func (b *tailBuffer) String() string {
+	if b.truncated > 0 {
+		return fmt.Sprintf("... [omitted %d lines, truncated %d bytes]\n%s", b.dropped, b.truncated, b.buf)
+	}
+	if b.dropped > 0 {
+		return fmt.Sprintf("... [omitted %d lines]\n%s", b.dropped, b.buf)
+	}
+	return string(b.buf)
+}
+
+type outputBuffer interface {
+	io.Writer
+	String() string
+}
+
+// syncWriter makes the writer safe for both stdout and stderr
+type syncWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.w.Write(p)
+}
+
+// Command is the sub process which could be terminated on timeout
+type Command struct {
+	Args      []string
+	Dir       string
+	Env       []string
+	Stdin     []byte
+	Timeout   time.Duration
+	KillGrace time.Duration
+
+	// Combined writes stdout and stderr into Stdout of the result in order
+	Combined bool
+	// MaxOutput is the max bytes kept for each stream
+	MaxOutput int64
+	// TailLines keeps only the last lines for each stream,
+	// and MaxOutput is applied to the last lines
+	TailLines int
+	// Output receives a copy of stdout and stderr while the command runs
+	Output io.Writer
+	// Attr is applied to the process before exec if not nil
+	Attr *ProcessAttr
+	// Started is called with the pid after the command starts
+	Started func(pid int)
+}
+
+func (c *Command) newBuffer() outputBuffer {
+	if c.TailLines > 0 {
+		return &tailBuffer{lines: c.TailLines, limit: c.MaxOutput}
+	}
+	return &limitBuffer{limit: c.MaxOutput}
+}
+
+// CommandResult is the result of the finished command
+type CommandResult struct {
+	ExitCode  int
+	Stdout    string
+	Stderr    string
+	TimedOut  bool
+	Canceled  bool
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// newCmd creates the process, which could not be started again after failure
+func (c *Command) newCmd(stdout, stderr io.Writer) *exec.Cmd {
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Dir = c.Dir
+	setProcessGroup(cmd)
+	return cmd
+}
+
+// Run will run the command and wait for it. On timeout or CancelCommands
+// the process group gets SIGTERM, then SIGKILL after the kill grace,
+// and the partial output is kept in the result
+func (c *Command) Run() (*CommandResult, error) {
+	stdoutBuf := c.newBuffer()
+	stderrBuf := c.newBuffer()
+
+	ctx := commandCtx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	killGrace := c.KillGrace
+	if killGrace <= 0 {
+		killGrace = DefaultKillGrace
+	}
+
+	var stdout, stderr io.Writer = stdoutBuf, stderrBuf
+	if c.Output != nil {
+		output := &syncWriter{w: c.Output}
+		stdout = io.MultiWriter(stdout, output)
+		stderr = io.MultiWriter(stderr, output)
+	}
+	if c.Combined {
+		stdout = &syncWriter{w: stdout}
+		stderr = stdout
+	}
+
+	startTime := time.Now()
+
+	if ctx.Err() != nil {
+		return &CommandResult{ExitCode: -1, Canceled: true, StartTime: startTime, EndTime: startTime}, nil
+	}
+
+	var cmd *exec.Cmd
+	var helper *processHelper
+	var err error
+	for retry := 0; ; retry++ {
+		cmd = c.newCmd(stdout, stderr)
+
+		if c.Attr != nil {
+			helper, err = c.Attr.prepare(cmd)
+			if err != nil {
+				return nil, fmt.Errorf("Prepare process attributes error: %s", err)
+			}
+		}
+
+		err = cmd.Start()
+		if err == nil {
+			break
+		}
+		helper.close()
+
+		if !isTextBusy(err) || retry >= textBusyRetries {
+			return nil, fmt.Errorf(`Start command "%v" error: %s`, c.Args, err)
+		}
+		time.Sleep(textBusyRetryDelay)
+	}
+
+	if c.Attr != nil {
+		err = c.Attr.apply(cmd.Process.Pid, helper)
+		if err != nil {
+			killProcessGroup(cmd)
+			cmd.Wait()
+			return nil, fmt.Errorf("Apply process attributes error: %s", err)
+		}
+	}
+
+	if c.Started != nil {
+		c.Started(cmd.Process.Pid)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		terminateProcessGroup(cmd)
+		select {
+		case <-time.After(killGrace):
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+
+	result := &CommandResult{
+		Stdout:    stdoutBuf.String(),
+		Stderr:    stderrBuf.String(),
+		StartTime: startTime,
+		EndTime:   time.Now(),
+	}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		result.TimedOut = true
+	case context.Canceled:
+		result.Canceled = true
+	}
+
+	if err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf(`Run command "%v" error: %s`, c.Args, err)
+		}
+		result.ExitCode = exitError.ExitCode()
+	}
+
+	return result, nil
+}
+
+// CheckCommandResult returns error if the command in result
+// timed out, was canceled or exited with non-zero code
+func CheckCommandResult(result map[string]interface{}) error {
+	timedOut, _ := GetBoolParam(result, "timed_out")
+	if timedOut {
+		return errors.New("Command timed out")
+	}
+
+	canceled, _ := GetBoolParam(result, "canceled")
+	if canceled {
+		return errors.New("Command canceled")
+	}
+
+	exitCode, _ := ToFloat(result["exit_code"])
+	if int(exitCode) != 0 {
+		return fmt.Errorf("Command failed with code %d", int(exitCode))
+	}
+
+	return nil
+}
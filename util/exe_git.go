@@ -1,11 +1,16 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	ssh2 "golang.org/x/crypto/ssh"
 	"gopkg.in/src-d/go-git.v4"
@@ -19,12 +24,35 @@ import (
 // ExeGit executes script from git repository
 type ExeGit struct {
 	BaseLogger
-	WorkDir string
+	WorkDir   string
+	Timeout   time.Duration
+	KillGrace time.Duration
+	MaxOutput int64
+	LogOutput bool
+	LogKeep   int
+	LogMaxAge time.Duration
+	// FetchTimeout limits the time of fetching repositories, no limit if zero.
+	// The fetch is also canceled by CancelCommands
+	FetchTimeout time.Duration
+	// RepoDirName is the directory name of repositories under WorkDir,
+	// the default is "gitrepo"
+	RepoDirName string
+
+	// ProcessParam is the default process attribute params
+	ProcessParam map[string]interface{}
+	// ShellInterpreter is the default interpreter for shell mode
+	ShellInterpreter []string
+	// ParamMode is the default way to pass the execution param
+	ParamMode    string
+	ParamFlatten bool
 }
 
 const (
-	defaultParamEnvName = "HERALD_EXECUTE_PARAM"
-	anonymousRemoteName = "herald-executor-remote-anonymous"
+	defaultParamEnvName     = "HERALD_EXECUTE_PARAM"
+	gitRepoDirEnvName       = "HERALD_GIT_REPO_DIR"
+	defaultShellInterpreter = "/bin/sh"
+	flattenEnvPrefix        = "HERALD"
+	anonymousRemoteName     = "herald-executor-remote-anonymous"
 )
 
 var sshDefaultKeyFiles = [...]string{"id_dsa", "id_ecdsa", "id_ed25519", "id_rsa"}
@@ -122,17 +150,19 @@ func (exe *ExeGit) getParam(repo, username, password, key, keyFile, keyPassword
 		auth = exe.getSSHAuth(endpoint, username, password, []byte(key), keyFile, keyPassword)
 	}
 
+	return getRepoPath(endpoint), endpoint.String(), auth, nil
+}
+
+func getRepoPath(endpoint *transport.Endpoint) string {
 	repoPathFrags := make([]string, 0, 16)
 	repoPathFrags = append(repoPathFrags, endpoint.Host)
 	urlPath := strings.TrimLeft(endpoint.Path, "/")
 	urlPath = strings.TrimSuffix(urlPath, ".git")
 	repoPathFrags = append(repoPathFrags, strings.Split(urlPath, "/")...)
-	repoPath := filepath.Join(repoPathFrags...)
-
-	return repoPath, endpoint.String(), auth, nil
+	return filepath.Join(repoPathFrags...)
 }
 
-func (exe *ExeGit) getRepo(repoDir, url string, auth transport.AuthMethod) (*git.Repository, error) {
+func openRepo(repoDir string) (*git.Repository, error) {
 	repo, err := git.PlainOpen(repoDir)
 
 	if err != nil {
@@ -146,22 +176,87 @@ func (exe *ExeGit) getRepo(repoDir, url string, auth transport.AuthMethod) (*git
 		}
 	}
 
+	return repo, nil
+}
+
+// abandonedFetches keeps the repository directories with fetches
+// still running after timeout or cancel
+var abandonedFetches = struct {
+	mutex sync.Mutex
+	dirs  map[string]bool
+}{
+	dirs: make(map[string]bool),
+}
+
+// fetchRemote returns when the context is done even if the fetch does not
+// respond to it. The repository could not be fetched again until
+// the abandoned fetch exits
+func fetchRemote(ctx context.Context, repoDir string, remote *git.Remote, o *git.FetchOptions) error {
+	abandonedFetches.mutex.Lock()
+	abandoned := abandonedFetches.dirs[repoDir]
+	abandonedFetches.mutex.Unlock()
+	if abandoned {
+		return errors.New("The last fetch is still running")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- remote.FetchContext(ctx, o)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	abandonedFetches.mutex.Lock()
+	abandonedFetches.dirs[repoDir] = true
+	abandonedFetches.mutex.Unlock()
+
+	go func() {
+		<-done
+		abandonedFetches.mutex.Lock()
+		delete(abandonedFetches.dirs, repoDir)
+		abandonedFetches.mutex.Unlock()
+	}()
+
+	return ctx.Err()
+}
+
+func (exe *ExeGit) getRepo(repoDir, url string, auth transport.AuthMethod, refSpecs []config.RefSpec, tags git.TagMode) (*git.Repository, error) {
+	repo, err := openRepo(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
 	remote, err := repo.CreateRemoteAnonymous(&config.RemoteConfig{
 		Name:  "anonymous",
 		URLs:  []string{url},
-		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/" + anonymousRemoteName + "/*"},
+		Fetch: refSpecs,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = remote.Fetch(&git.FetchOptions{
+	ctx := commandCtx
+	if exe.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, exe.FetchTimeout)
+		defer cancel()
+	}
+
+	err = fetchRemote(ctx, repoDir, remote, &git.FetchOptions{
 		Auth:  auth,
 		Force: true,
+		Tags:  tags,
 	})
 
 	if err != nil {
 		if err != git.NoErrAlreadyUpToDate {
+			if err == context.DeadlineExceeded {
+				return nil, fmt.Errorf("Fetch timed out after %s", exe.FetchTimeout)
+			}
 			return nil, err
 		}
 		exe.Debugf("Repo already up to date")
@@ -215,11 +310,11 @@ func (exe *ExeGit) loadBranch(repo *git.Repository, branch string) error {
 	return nil
 }
 
-func (exe *ExeGit) loadRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, branch string) (string, error) {
+func (exe *ExeGit) fetchRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword string, refSpecs []config.RefSpec, tags git.TagMode) (*git.Repository, string, string, error) {
 	repoDir, url, auth, err := exe.getParam(repo, username, password, sshKey, sshKeyFile, sshKeyPassword)
 	if err != nil {
 		exe.Errorf("Get repo param error: %s", err)
-		return "", errors.New("Get repo param error")
+		return nil, "", "", errors.New("Get repo param error")
 	}
 
 	repoDir = filepath.Join(exe.WorkRepoDir(), repoDir)
@@ -230,10 +325,46 @@ func (exe *ExeGit) loadRepo(repo, username, password, sshKey, sshKeyFile, sshKey
 		exe.Debugf("Repo auth: %s", auth.Name())
 	}
 
-	gitRepo, err := exe.getRepo(repoDir, url, auth)
+	gitRepo, err := exe.getRepo(repoDir, url, auth, refSpecs, tags)
 	if err != nil {
 		exe.Errorf("Get repo error: %s", err)
-		return "", errors.New("Get repo error")
+		return nil, "", "", errors.New("Get repo error")
+	}
+
+	return gitRepo, repoDir, url, nil
+}
+
+// OpenRepo opens the local repository in the work directory without fetching
+func (exe *ExeGit) OpenRepo(repo string) (*git.Repository, error) {
+	endpoint, err := transport.NewEndpoint(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return openRepo(filepath.Join(exe.WorkRepoDir(), getRepoPath(endpoint)))
+}
+
+// FetchRepo fetches the remote repository into the work directory
+// with the refspecs only, and returns the local repository and the URL
+func (exe *ExeGit) FetchRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword string, refSpecs []string) (*git.Repository, string, error) {
+	configRefSpecs := make([]config.RefSpec, 0, len(refSpecs))
+	for _, refSpec := range refSpecs {
+		configRefSpecs = append(configRefSpecs, config.RefSpec(refSpec))
+	}
+
+	gitRepo, _, url, err := exe.fetchRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, configRefSpecs, git.NoTags)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return gitRepo, url, nil
+}
+
+func (exe *ExeGit) loadRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, branch string) (string, error) {
+	refSpecs := []config.RefSpec{"+refs/heads/*:refs/remotes/" + anonymousRemoteName + "/*"}
+	gitRepo, repoDir, _, err := exe.fetchRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, refSpecs, git.TagFollowing)
+	if err != nil {
+		return "", err
 	}
 
 	err = exe.loadBranch(gitRepo, branch)
@@ -269,22 +400,86 @@ func (exe *ExeGit) Execute(param map[string]interface{}) (map[string]interface{}
 	background, _ := GetBoolParam(jobParam, "background")
 	ignoreParamEnv, _ := GetBoolParam(jobParam, "ignore_param_env")
 
-	var finalCommand string
-	if repo == "" {
-		finalCommand = cmd
-	} else {
+	paramMode, err := GetStringParam(jobParam, "param_mode")
+	if err != nil {
+		paramMode = exe.ParamMode
+	}
+	if paramMode == "" {
+		paramMode = "env"
+	}
+	if ignoreParamEnv {
+		paramMode = "none"
+	}
+	if paramMode != "env" && paramMode != "stdin" && paramMode != "file" && paramMode != "none" {
+		exe.Errorf(`Invalid param_mode "%s"`, paramMode)
+		return nil, errors.New("Invalid param_mode")
+	}
+
+	paramFlatten, err := GetBoolParam(jobParam, "param_flatten")
+	if err != nil {
+		paramFlatten = exe.ParamFlatten
+	}
+
+	shell, _ := GetBoolParam(jobParam, "shell")
+	shellInterpreter, err := GetStringSliceParam(jobParam, "shell_interpreter")
+	if err != nil {
+		shellInterpreter = exe.ShellInterpreter
+	}
+	if len(shellInterpreter) == 0 {
+		shellInterpreter = []string{defaultShellInterpreter}
+	}
+	script, _ := GetStringParam(jobParam, "script")
+	interpreter, _ := GetStringSliceParam(jobParam, "interpreter")
+
+	combinedOutput, _ := GetBoolParam(jobParam, "combined_output")
+
+	maxOutput := exe.MaxOutput
+	if value, ok := jobParam["max_output_size"]; ok {
+		size, err := ParseSize(value)
+		if err != nil {
+			exe.Warnf("Invalid max_output_size: %s", err)
+		} else {
+			maxOutput = int64(size)
+		}
+	}
+
+	tailLines, _ := GetIntParam(jobParam, "tail_lines")
+
+	logOutput, err := GetBoolParam(jobParam, "log_output")
+	if err != nil {
+		logOutput = exe.LogOutput
+	}
+
+	processAttr, err := ParseProcessAttr(MergeProcessParam(jobParam, exe.ProcessParam))
+	if err != nil {
+		exe.Errorf("Invalid process attributes: %s", err)
+		return nil, errors.New("Invalid process attributes")
+	}
+
+	timeout := exe.Timeout
+	timeoutSecond, err := GetIntParam(jobParam, "timeout")
+	if err == nil {
+		timeout = time.Duration(timeoutSecond) * time.Second
+	}
+
+	if script != "" && (cmd != "" || repo != "") {
+		exe.Errorf("Param script could not be used with cmd or git_repo")
+		return nil, errors.New("Param script could not be used with cmd or git_repo")
+	}
+
+	var repoPath string
+	if repo != "" {
 		if branch == "" {
 			branch = "master"
 		}
-		repoPath, err := exe.loadRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, branch)
+		repoPath, err = exe.loadRepo(repo, username, password, sshKey, sshKeyFile, sshKeyPassword, branch)
 		if err != nil {
 			exe.Errorf("Load git repository failed: %s", err)
 			return nil, errors.New("Load git repository failed")
 		}
-		finalCommand = filepath.Join(repoPath, cmd)
 	}
 
-	if finalCommand == "" {
+	if cmd == "" && script == "" {
 		exe.Errorf("Could not execute empty command")
 		return nil, errors.New("Could not execute empty command")
 	}
@@ -299,8 +494,23 @@ func (exe *ExeGit) Execute(param map[string]interface{}) (map[string]interface{}
 		envList = append(envList, k+"="+value)
 	}
 
-	if !ignoreParamEnv {
-		paramEnvBytes, err := json.Marshal(param)
+	// the temporary files are kept until the background job finishes
+	var cleanups []func()
+	cleanup := func() {
+		for _, f := range cleanups {
+			f()
+		}
+	}
+	backgroundStarted := false
+	defer func() {
+		if !backgroundStarted {
+			cleanup()
+		}
+	}()
+
+	var stdin []byte
+	if paramMode != "none" {
+		paramBytes, err := json.Marshal(param)
 		if err != nil {
 			exe.Errorf("Generate param env failed: %s", err)
 			return nil, errors.New("Generate param env failed")
@@ -308,44 +518,226 @@ func (exe *ExeGit) Execute(param map[string]interface{}) (map[string]interface{}
 		if paramEnvName == "" {
 			paramEnvName = defaultParamEnvName
 		}
-		envList = append(envList, paramEnvName+"="+string(paramEnvBytes))
+
+		switch paramMode {
+		case "env":
+			envList = append(envList, paramEnvName+"="+string(paramBytes))
+		case "stdin":
+			stdin = paramBytes
+		case "file":
+			paramFile, err := exe.createTempFile("param-", paramBytes, 0600, processAttr)
+			if err != nil {
+				exe.Errorf("Create param file error: %s", err)
+				return nil, errors.New("Create param file error")
+			}
+			cleanups = append(cleanups, func() { os.Remove(paramFile) })
+			envList = append(envList, paramEnvName+"_FILE="+paramFile)
+		}
+	}
+
+	if paramFlatten {
+		envList = append(envList, FlattenParamEnv(flattenEnvPrefix, param)...)
+	}
+
+	if repoPath != "" {
+		envList = append(envList, gitRepoDirEnvName+"="+repoPath)
 	}
 
+	// All the commands run in the same directory, the repo is only read
 	runDir := exe.WorkRunDir()
-	err := os.MkdirAll(runDir, 0755)
+	err = os.MkdirAll(runDir, 0755)
 	if err != nil {
 		exe.Errorf(`Create run directory "%s" failed: %s`, runDir, err)
 	}
 
-	fullCommand := []string{finalCommand}
+	var fullCommand []string
+	switch {
+	case script != "":
+		scriptFile, err := exe.createTempFile("script-", []byte(script), 0700, processAttr)
+		if err != nil {
+			exe.Errorf("Create script file error: %s", err)
+			return nil, errors.New("Create script file error")
+		}
+		cleanups = append(cleanups, func() { os.Remove(scriptFile) })
+		fullCommand = append(fullCommand, interpreter...)
+		fullCommand = append(fullCommand, scriptFile)
+	case shell:
+		// the arguments are $1, $2... of the shell command
+		fullCommand = append(fullCommand, shellInterpreter...)
+		fullCommand = append(fullCommand, "-c", cmd, shellInterpreter[0])
+	case repoPath != "":
+		fullCommand = append(fullCommand, filepath.Join(repoPath, cmd))
+	default:
+		fullCommand = append(fullCommand, cmd)
+	}
 	fullCommand = append(fullCommand, arg...)
 
-	var stdout string
 	exe.Debugf("Execute command: %v", fullCommand)
-	exitCode, err := RunCmd(fullCommand, runDir, envList, background, &stdout, nil)
+
+	command := &Command{
+		Args:      fullCommand,
+		Dir:       runDir,
+		Env:       envList,
+		Stdin:     stdin,
+		Timeout:   timeout,
+		KillGrace: exe.KillGrace,
+		Combined:  combinedOutput,
+		MaxOutput: maxOutput,
+		TailLines: tailLines,
+		Attr:      processAttr,
+	}
+
+	var logFile string
+	if logOutput {
+		f, fn := exe.createJobLog(param)
+		if f != nil {
+			cleanups = append(cleanups, func() { closeJobLog(f) })
+			command.Output = f
+			logFile = fn
+		}
+	}
+
+	getResult := func(cmdResult *CommandResult) map[string]interface{} {
+		if cmdResult.TimedOut {
+			exe.Warnf("Command %v timed out after %s", fullCommand, timeout)
+		}
+		if cmdResult.Canceled {
+			exe.Warnf("Command %v canceled", fullCommand)
+		}
+		return commandResultMap(cmdResult, combinedOutput, logFile)
+	}
+
+	if background {
+		getBackgroundTracker(exe.BackgroundStatusFile()).runBackground(&exe.BaseLogger, param, command, getResult, cleanup)
+		backgroundStarted = true
+		return map[string]interface{}{
+			"output":     "",
+			"exit_code":  0,
+			"background": true,
+		}, nil
+	}
+
+	cmdResult, err := command.Run()
 	if err != nil {
 		exe.Errorf("Execute command error: %s", err)
 		return nil, errors.New("Execute command error")
 	}
 
-	result, err := JSONToMap([]byte(stdout))
+	return getResult(cmdResult), nil
+}
+
+// commandResultMap converts the command result, the stdout is
+// merged into the result if it is json
+func commandResultMap(cmdResult *CommandResult, combinedOutput bool, logFile string) map[string]interface{} {
+	result, err := JSONToMap([]byte(cmdResult.Stdout))
 	if err != nil {
-		return map[string]interface{}{
-			"output":    stdout,
-			"exit_code": exitCode,
-		}, nil
+		result = map[string]interface{}{
+			"output": cmdResult.Stdout,
+		}
 	}
 
-	result["exit_code"] = exitCode
+	result["exit_code"] = cmdResult.ExitCode
+	if !combinedOutput {
+		result["stderr"] = cmdResult.Stderr
+	}
+	result["start_time"] = cmdResult.StartTime.Format(time.RFC3339Nano)
+	result["end_time"] = cmdResult.EndTime.Format(time.RFC3339Nano)
+	result["duration"] = cmdResult.EndTime.Sub(cmdResult.StartTime).Seconds()
+	if logFile != "" {
+		result["log_file"] = logFile
+	}
+	if cmdResult.TimedOut {
+		result["timed_out"] = true
+	}
+	if cmdResult.Canceled {
+		result["canceled"] = true
+	}
+
+	return result
+}
+
+// createJobLog creates the log file for the job output,
+// and then cleans the old ones of the same router task
+func (exe *ExeGit) createJobLog(param map[string]interface{}) (*os.File, string) {
+	router, _ := GetStringParam(param, "router")
+	task, _ := GetStringParam(param, "task")
+	jobID, err := GetStringParam(param, "job_id")
+	if err != nil {
+		jobID, _ = GetStringParam(param, "id")
+	}
+
+	dir := jobLogDir(exe.WorkLogDir(), router, task)
+
+	f, err := createJobLog(dir, jobID)
+	if err != nil {
+		exe.Errorf(`Create job log in "%s" error: %s`, dir, err)
+		return nil, ""
+	}
 
-	return result, nil
+	removed, err := cleanJobLogs(dir, exe.LogKeep, exe.LogMaxAge)
+	if err != nil {
+		exe.Warnf(`Clean job logs in "%s" error: %s`, dir, err)
+	}
+	for _, fn := range removed {
+		exe.Debugf(`Old job log "%s" removed`, fn)
+	}
+
+	return f, f.Name()
 }
 
-// WorkRepoDir return the run directory
+// createTempFile writes the content into a temporary file with the mode,
+// which is owned by the user running the command
+func (exe *ExeGit) createTempFile(prefix string, content []byte, mode os.FileMode, attr *ProcessAttr) (string, error) {
+	tempDir := exe.WorkTempDir()
+	err := os.MkdirAll(tempDir, 0711)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(tempDir, prefix)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	err = f.Chmod(mode)
+	if err == nil {
+		_, err = f.Write(content)
+	}
+	if err == nil && attr != nil {
+		err = attr.chown(f.Name())
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// WorkRepoDir return the repository directory
 func (exe *ExeGit) WorkRepoDir() string {
+	if exe.RepoDirName != "" {
+		return filepath.Join(exe.WorkDir, exe.RepoDirName)
+	}
 	return filepath.Join(exe.WorkDir, "gitrepo")
 }
 
+// WorkLogDir return the job log directory
+func (exe *ExeGit) WorkLogDir() string {
+	return filepath.Join(exe.WorkDir, "logs")
+}
+
+// WorkTempDir return the directory of temporary scripts and param files
+func (exe *ExeGit) WorkTempDir() string {
+	return filepath.Join(exe.WorkDir, "tmp")
+}
+
+// BackgroundStatusFile return the status file of background jobs
+func (exe *ExeGit) BackgroundStatusFile() string {
+	return filepath.Join(exe.WorkDir, "background.json")
+}
+
 // WorkRunDir return the run directory
 func (exe *ExeGit) WorkRunDir() string {
 	return filepath.Join(exe.WorkDir, "run")
@@ -0,0 +1,284 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	exprResultName = "result"
+	exprMaxSteps   = 100000
+)
+
+// Expr is a compiled starlark expression which could be evaluated with variables
+//
+// Maps in the variables support member access like "a.b" besides "a['b']",
+// and missing members are evaluated as None. The functions "matches",
+// "get" and "has" are provided besides the starlark builtins.
+type Expr struct {
+	text     string
+	prog     *starlark.Program
+	names    []string
+	builtins starlark.StringDict
+
+	regexpMutex sync.Mutex
+	regexpCache map[string]*regexp.Regexp
+}
+
+// CompileExpr compiles the expression text
+func CompileExpr(text string) (*Expr, error) {
+	expr, err := syntax.ParseExpr("expr", text, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Expr{
+		text:        text,
+		regexpCache: make(map[string]*regexp.Regexp),
+	}
+	e.builtins = starlark.StringDict{
+		"matches": starlark.NewBuiltin("matches", e.funcMatches),
+		"get":     starlark.NewBuiltin("get", exprFuncGet),
+		"has":     starlark.NewBuiltin("has", exprFuncHas),
+	}
+
+	// Names not in the universe are taken as variables,
+	// and checked before each evaluation
+	isPredeclared := func(name string) bool {
+		if starlark.Universe.Has(name) {
+			return false
+		}
+		e.names = append(e.names, name)
+		return true
+	}
+
+	f := &syntax.File{
+		Stmts: []syntax.Stmt{
+			&syntax.AssignStmt{
+				Op:  syntax.EQ,
+				LHS: &syntax.Ident{Name: exprResultName},
+				RHS: expr,
+			},
+		},
+	}
+	e.prog, err = starlark.FileProgram(f, isPredeclared)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// String returns the text of the expression
+func (e *Expr) String() string {
+	return e.text
+}
+
+func (e *Expr) eval(vars map[string]interface{}) (starlark.Value, error) {
+	predeclared := make(starlark.StringDict, len(e.names))
+	for _, name := range e.names {
+		if value, ok := vars[name]; ok {
+			predeclared[name] = exprValue(value)
+		} else if builtin, ok := e.builtins[name]; ok {
+			predeclared[name] = builtin
+		} else {
+			return nil, fmt.Errorf(`Unknown variable "%s"`, name)
+		}
+	}
+
+	thread := &starlark.Thread{
+		Name: "expr",
+	}
+	thread.SetMaxExecutionSteps(exprMaxSteps)
+
+	globals, err := e.prog.Init(thread, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	return globals[exprResultName], nil
+}
+
+// EvalBool evaluates the expression and requires a bool result
+func (e *Expr) EvalBool(vars map[string]interface{}) (bool, error) {
+	result, err := e.eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	resultBool, ok := result.(starlark.Bool)
+	if !ok {
+		return false, fmt.Errorf("Expression result is not a bool: %s", result)
+	}
+	return bool(resultBool), nil
+}
+
+// EvalNumber evaluates the expression and requires a number result
+func (e *Expr) EvalNumber(vars map[string]interface{}) (float64, error) {
+	result, err := e.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	var number float64
+	switch v := result.(type) {
+	case starlark.Int, starlark.Float:
+		number, _ = starlark.AsFloat(v)
+	default:
+		return 0, fmt.Errorf("Expression result is not a number: %s", result)
+	}
+	return number, nil
+}
+
+func (e *Expr) compileRegexp(pattern string) (*regexp.Regexp, error) {
+	e.regexpMutex.Lock()
+	defer e.regexpMutex.Unlock()
+
+	re, ok := e.regexpCache[pattern]
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	e.regexpCache[pattern] = re
+	return re, nil
+}
+
+func (e *Expr) funcMatches(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s, pattern string
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &s, &pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := e.compileRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Bool(re.MatchString(s)), nil
+}
+
+func exprNestedArgs(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (exprMap, string, error) {
+	var v starlark.Value
+	var key string
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &v, &key)
+	if err != nil {
+		return nil, "", err
+	}
+	m, _ := v.(exprMap)
+	return m, key, nil
+}
+
+// exprFuncGet gets the nested value like "a/b/c", the same as match_key
+func exprFuncGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	m, key, err := exprNestedArgs(b, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	value, err := GetNestedMapValue(m, key)
+	if err != nil {
+		return starlark.None, nil
+	}
+	return exprValue(value), nil
+}
+
+// exprFuncHas checks the existence of nested keys like "a/b/c"
+func exprFuncHas(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	m, key, err := exprNestedArgs(b, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	_, err = GetNestedMapValue(m, key)
+	return starlark.Bool(err == nil), nil
+}
+
+// exprValue converts the param into starlark value, maps are wrapped
+// so that the members could be accessed without conversion
+func exprValue(v interface{}) starlark.Value {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return exprMap(value)
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(value))
+		for _, item := range value {
+			elems = append(elems, exprValue(item))
+		}
+		list := starlark.NewList(elems)
+		list.Freeze()
+		return list
+	}
+
+	result, err := ToStarlarkValue(v)
+	if err != nil {
+		return starlark.String(fmt.Sprint(v))
+	}
+	return result
+}
+
+// exprMap is a read only starlark map with member access
+type exprMap map[string]interface{}
+
+func (m exprMap) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m exprMap) String() string {
+	value, err := ToStarlarkValue(map[string]interface{}(m))
+	if err != nil {
+		return fmt.Sprint(map[string]interface{}(m))
+	}
+	return value.String()
+}
+
+func (m exprMap) Type() string         { return "dict" }
+func (m exprMap) Freeze()              {}
+func (m exprMap) Truth() starlark.Bool { return len(m) > 0 }
+func (m exprMap) Len() int             { return len(m) }
+
+func (m exprMap) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: dict")
+}
+
+// Attr returns None for missing keys, so the existence could be checked
+func (m exprMap) Attr(name string) (starlark.Value, error) {
+	value, ok := m[name]
+	if !ok {
+		return starlark.None, nil
+	}
+	return exprValue(value), nil
+}
+
+func (m exprMap) AttrNames() []string {
+	return m.keys()
+}
+
+func (m exprMap) Get(k starlark.Value) (starlark.Value, bool, error) {
+	key, ok := k.(starlark.String)
+	if !ok {
+		return nil, false, nil
+	}
+	value, ok := m[string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	return exprValue(value), true, nil
+}
+
+func (m exprMap) Iterate() starlark.Iterator {
+	keys := make([]starlark.Value, 0, len(m))
+	for _, k := range m.keys() {
+		keys = append(keys, starlark.String(k))
+	}
+	return starlark.NewList(keys).Iterate()
+}
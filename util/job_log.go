@@ -0,0 +1,111 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jobLogSuffix = ".log"
+
+// openJobLogs keeps the log files of the running jobs,
+// which should not be removed by cleanJobLogs
+var openJobLogs = struct {
+	mutex sync.Mutex
+	paths map[string]bool
+}{
+	paths: make(map[string]bool),
+}
+
+// safePathName makes the name usable as a single path element
+func safePathName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// jobLogDir returns the log directory of the router task
+func jobLogDir(logDir, router, task string) string {
+	return filepath.Join(logDir, safePathName(router), safePathName(task))
+}
+
+// createJobLog creates the log file for the job,
+// which must be closed by closeJobLog
+func createJobLog(dir, jobID string) (*os.File, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, safePathName(jobID)+jobLogSuffix), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	openJobLogs.mutex.Lock()
+	openJobLogs.paths[f.Name()] = true
+	openJobLogs.mutex.Unlock()
+
+	return f, nil
+}
+
+// closeJobLog closes the log file and allows it to be cleaned
+func closeJobLog(f *os.File) {
+	openJobLogs.mutex.Lock()
+	delete(openJobLogs.paths, f.Name())
+	openJobLogs.mutex.Unlock()
+
+	f.Close()
+}
+
+func isJobLogOpen(path string) bool {
+	openJobLogs.mutex.Lock()
+	defer openJobLogs.mutex.Unlock()
+	return openJobLogs.paths[path]
+}
+
+// cleanJobLogs removes the log files older than maxAge, and the oldest
+// ones beyond the keep count, no limit for zero values.
+// The log files of the running jobs are kept
+func cleanJobLogs(dir string, keep int, maxAge time.Duration) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []os.FileInfo
+	for _, f := range files {
+		if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), jobLogSuffix) {
+			logs = append(logs, f)
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].ModTime().After(logs[j].ModTime())
+	})
+
+	var removed []string
+	now := time.Now()
+	for i, f := range logs {
+		if (keep <= 0 || i < keep) && (maxAge <= 0 || now.Sub(f.ModTime()) <= maxAge) {
+			continue
+		}
+		fn := filepath.Join(dir, f.Name())
+		if isJobLogOpen(fn) {
+			continue
+		}
+		err := os.Remove(fn)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, fn)
+	}
+
+	return removed, nil
+}
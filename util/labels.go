@@ -0,0 +1,92 @@
+package util
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const osReleaseFile = "/etc/os-release"
+
+// ReadOSRelease reads the key value pairs in os-release file
+func ReadOSRelease(fn string) (map[string]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		frags := strings.SplitN(line, "=", 2)
+		if len(frags) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(frags[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		result[strings.TrimSpace(frags[0])] = value
+	}
+
+	return result, scanner.Err()
+}
+
+func readKernelRelease() string {
+	content, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err == nil {
+		return strings.TrimSpace(string(content))
+	}
+
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+
+	output, err := exec.Command("uname", "-r").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// DefaultLabels returns the labels of the host,
+// which could not be found are omitted
+func DefaultLabels() map[string]interface{} {
+	labels := map[string]interface{}{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+
+	hostname, err := os.Hostname()
+	if err == nil {
+		labels["hostname"] = hostname
+	}
+
+	kernel := readKernelRelease()
+	if kernel != "" {
+		labels["kernel"] = kernel
+	}
+
+	osRelease, err := ReadOSRelease(osReleaseFile)
+	if err == nil {
+		if osRelease["ID"] != "" {
+			labels["distro"] = osRelease["ID"]
+		}
+		if osRelease["VERSION_ID"] != "" {
+			labels["distro_version"] = osRelease["VERSION_ID"]
+		}
+	}
+
+	return labels
+}
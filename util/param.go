@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -188,28 +191,215 @@ func GetStringSliceParam(param map[string]interface{}, name string) ([]string, e
 	return strSliceValue, nil
 }
 
-// GetNestedMapValue get the value of a nested key from the map
-// map["a/b/c"] = map["a"]["b"]["c"]
-func GetNestedMapValue(param map[string]interface{}, nestedKey string) (interface{}, error) {
-	var currentParam interface{}
+type nestedKeySegment struct {
+	name     string
+	wildcard bool
+}
 
-	frags := strings.Split(nestedKey, "/")
-	currentKeys := make([]string, 0, len(frags))
+// splitNestedKey splits the nested key by "/", where "\/" is a literal
+// slash, "\\" is a literal backslash and "\*" is a literal star
+func splitNestedKey(nestedKey string) []nestedKeySegment {
+	var segments []nestedKeySegment
+	var current strings.Builder
+	escaped := false
+	literal := false
+
+	for _, c := range nestedKey {
+		if escaped {
+			if c != '/' && c != '\\' && c != '*' {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(c)
+			escaped = false
+			literal = true
+			continue
+		}
 
-	currentParam = param
-	for _, frag := range frags {
-		currentMap, ok := currentParam.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf(`Get nested map value error: "%s" is not a map`, strings.Join(currentKeys, "/"))
+		switch c {
+		case '\\':
+			escaped = true
+		case '/':
+			segments = append(segments, nestedKeySegment{
+				name:     current.String(),
+				wildcard: !literal && current.String() == "*",
+			})
+			current.Reset()
+			literal = false
+		default:
+			current.WriteRune(c)
 		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+
+	segments = append(segments, nestedKeySegment{
+		name:     current.String(),
+		wildcard: !literal && current.String() == "*",
+	})
+
+	return segments
+}
 
-		currentKeys = append(currentKeys, frag)
+// HasNestedWildcard checks whether there is "*" in the nested key
+func HasNestedWildcard(nestedKey string) bool {
+	for _, seg := range splitNestedKey(nestedKey) {
+		if seg.wildcard {
+			return true
+		}
+	}
+	return false
+}
 
-		currentParam, ok = currentMap[frag]
+func nestedChildren(current interface{}, seg nestedKeySegment) ([]interface{}, error) {
+	switch v := current.(type) {
+	case map[string]interface{}:
+		if seg.wildcard {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			children := make([]interface{}, 0, len(v))
+			for _, k := range keys {
+				children = append(children, v[k])
+			}
+			return children, nil
+		}
+
+		child, ok := v[seg.name]
 		if !ok {
-			return nil, fmt.Errorf(`Get nested map value error: "%s" does not exist`, strings.Join(currentKeys, "/"))
+			return nil, errors.New("does not exist")
+		}
+		return []interface{}{child}, nil
+	case []interface{}:
+		if seg.wildcard {
+			return v, nil
+		}
+
+		index, err := strconv.Atoi(seg.name)
+		if err != nil {
+			return nil, errors.New("is a list but the index is not an integer")
+		}
+		if index < 0 {
+			index += len(v)
+		}
+		if index < 0 || index >= len(v) {
+			return nil, errors.New("index out of range")
+		}
+		return []interface{}{v[index]}, nil
+	}
+
+	return nil, errors.New("is not a map or list")
+}
+
+// GetNestedMapValues get all the values matching the nested key,
+// the segment could be list index and "*" matches all the children
+func GetNestedMapValues(param map[string]interface{}, nestedKey string) ([]interface{}, error) {
+	currentValues := []interface{}{param}
+	currentKeys := make([]string, 0)
+
+	for _, seg := range splitNestedKey(nestedKey) {
+		currentKeys = append(currentKeys, seg.name)
+
+		var nextValues []interface{}
+		var lastErr error
+		for _, current := range currentValues {
+			children, err := nestedChildren(current, seg)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			nextValues = append(nextValues, children...)
 		}
+
+		if len(nextValues) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("does not exist")
+			}
+			return nil, fmt.Errorf(`Get nested map value error: "%s" %s`, strings.Join(currentKeys, "/"), lastErr)
+		}
+		currentValues = nextValues
+	}
+
+	return currentValues, nil
+}
+
+// GetNestedMapValue get the value of a nested key from the map
+// map["a/b/c"] = map["a"]["b"]["c"]
+// list index like "a/0/b" and "a/-1/b" is supported,
+// and the list of all matches is returned if "*" is in the nested key
+func GetNestedMapValue(param map[string]interface{}, nestedKey string) (interface{}, error) {
+	values, err := GetNestedMapValues(param, nestedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if HasNestedWildcard(nestedKey) {
+		return values, nil
+	}
+	return values[0], nil
+}
+
+// ToFloat converts the numeric value to float64
+func ToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// ValueEqual checks whether the two values are equal,
+// numbers of different types are compared by value
+func ValueEqual(a, b interface{}) bool {
+	aFloat, aOk := ToFloat(a)
+	bFloat, bOk := ToFloat(b)
+	if aOk && bOk {
+		return aFloat == bFloat
+	}
+	if aOk || bOk {
+		return false
+	}
+
+	switch a.(type) {
+	case []interface{}, map[string]interface{}:
+		return reflect.DeepEqual(a, b)
+	}
+	switch b.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+
+	return a == b
+}
+
+// GetNumberParam get the number param from the map as float64
+func GetNumberParam(param map[string]interface{}, name string) (float64, error) {
+	numberParam, ok := param[name]
+	if !ok {
+		return 0, fmt.Errorf(`Param "%s" not found`, name)
+	}
+
+	numberValue, ok := ToFloat(numberParam)
+	if !ok {
+		return 0, fmt.Errorf(`Param "%s" is not a number`, name)
 	}
 
-	return currentParam, nil
+	return numberValue, nil
 }
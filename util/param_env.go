@@ -0,0 +1,59 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envName converts the key into upper case letters, digits and underscores
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func envValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// FlattenParamEnv exports each leaf of the param as an environment variable,
+// the name is the path of keys joined by "_" in upper case like
+// HERALD_TRIGGER_PARAM_BRANCH, and lists are kept as json
+func FlattenParamEnv(prefix string, param map[string]interface{}) []string {
+	keys := make([]string, 0, len(param))
+	for k := range param {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var envList []string
+	for _, k := range keys {
+		name := prefix + "_" + envName(k)
+		if subParam, ok := param[k].(map[string]interface{}); ok {
+			envList = append(envList, FlattenParamEnv(name, subParam)...)
+			continue
+		}
+		envList = append(envList, name+"="+envValue(param[k]))
+	}
+	return envList
+}
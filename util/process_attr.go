@@ -0,0 +1,210 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const processHelperEnv = "HERALD_PROCESS_HELPER"
+
+const rlimitInfinity = ^uint64(0)
+
+var processAttrKeys = []string{"user", "group", "umask", "rlimit", "nice", "ionice", "ionice_level"}
+
+var ioniceClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// ProcessAttr is the attributes applied to the command process before exec
+type ProcessAttr struct {
+	User        string
+	Group       string
+	Umask       int
+	Rlimit      map[string]uint64
+	Nice        int
+	SetNice     bool
+	IONiceClass int
+	IONiceLevel int
+}
+
+// MergeProcessParam gets the process attribute params from job param,
+// and falls back to the default ones. The rlimit maps are merged
+func MergeProcessParam(jobParam, defaultParam map[string]interface{}) map[string]interface{} {
+	param := make(map[string]interface{})
+	for _, key := range processAttrKeys {
+		if value, ok := defaultParam[key]; ok {
+			param[key] = value
+		}
+		if value, ok := jobParam[key]; ok {
+			param[key] = value
+		}
+	}
+
+	defaultRlimit, errDefault := GetMapParam(defaultParam, "rlimit")
+	jobRlimit, errJob := GetMapParam(jobParam, "rlimit")
+	if errDefault == nil && errJob == nil {
+		rlimit := make(map[string]interface{})
+		MergeMapParam(rlimit, defaultRlimit)
+		MergeMapParam(rlimit, jobRlimit)
+		param["rlimit"] = rlimit
+	}
+
+	return param
+}
+
+func parseUmask(value interface{}) (int, error) {
+	umask := -1
+	switch v := value.(type) {
+	case int:
+		umask = v
+	case float64:
+		if v == math.Trunc(v) {
+			umask = int(v)
+		}
+	case string:
+		parsed, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf(`Invalid umask "%s"`, v)
+		}
+		umask = int(parsed)
+	}
+	if umask < 0 || umask > 0777 {
+		return 0, fmt.Errorf("Invalid umask %v", value)
+	}
+	return umask, nil
+}
+
+// parseRlimit parses the limit, which is in seconds for "cpu" and could
+// also be a duration like "1m", or a size like "2GiB" for the others
+func parseRlimit(name string, value interface{}) (uint64, error) {
+	text, isText := value.(string)
+	if isText && strings.ToLower(text) == "unlimited" {
+		return rlimitInfinity, nil
+	}
+
+	if name == "cpu" {
+		seconds, ok := ToFloat(value)
+		if !ok && isText {
+			text = strings.TrimSpace(text)
+			duration, err := time.ParseDuration(text)
+			if err == nil {
+				seconds, ok = duration.Seconds(), true
+			} else {
+				seconds, err = strconv.ParseFloat(text, 64)
+				ok = err == nil
+			}
+		}
+		if !ok || seconds < 0 {
+			return 0, fmt.Errorf("Invalid limit %v", value)
+		}
+		return uint64(math.Ceil(seconds)), nil
+	}
+
+	size, err := ParseSize(value)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("Invalid limit %v", value)
+	}
+	return uint64(size), nil
+}
+
+// ParseProcessAttr parses the process attributes,
+// returns nil if no attribute is specified
+func ParseProcessAttr(param map[string]interface{}) (*ProcessAttr, error) {
+	if len(param) == 0 {
+		return nil, nil
+	}
+
+	attr := &ProcessAttr{
+		Umask:  -1,
+		Rlimit: make(map[string]uint64),
+	}
+
+	attr.User, _ = GetStringParam(param, "user")
+	attr.Group, _ = GetStringParam(param, "group")
+	if value, ok := param["user"].(int); ok {
+		attr.User = strconv.Itoa(value)
+	}
+	if value, ok := param["group"].(int); ok {
+		attr.Group = strconv.Itoa(value)
+	}
+
+	if value, ok := param["umask"]; ok {
+		umask, err := parseUmask(value)
+		if err != nil {
+			return nil, err
+		}
+		attr.Umask = umask
+	}
+
+	if _, ok := param["rlimit"]; ok {
+		rlimit, err := GetMapParam(param, "rlimit")
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range rlimit {
+			if _, ok := rlimitResources[name]; !ok {
+				return nil, fmt.Errorf(`Unknown rlimit "%s"`, name)
+			}
+			limit, err := parseRlimit(name, value)
+			if err != nil {
+				return nil, fmt.Errorf(`Rlimit "%s": %s`, name, err)
+			}
+			attr.Rlimit[name] = limit
+		}
+	}
+
+	if _, ok := param["nice"]; ok {
+		nice, err := GetIntParam(param, "nice")
+		if err != nil || nice < -20 || nice > 19 {
+			return nil, fmt.Errorf("Invalid nice %v", param["nice"])
+		}
+		attr.Nice = nice
+		attr.SetNice = true
+	}
+
+	if _, ok := param["ionice"]; ok {
+		class, _ := GetStringParam(param, "ionice")
+		attr.IONiceClass, ok = ioniceClasses[class]
+		if !ok {
+			return nil, fmt.Errorf(`Invalid ionice class "%v"`, param["ionice"])
+		}
+		attr.IONiceLevel = 4
+		if _, ok := param["ionice_level"]; ok {
+			level, err := GetIntParam(param, "ionice_level")
+			if err != nil || level < 0 || level > 7 {
+				return nil, fmt.Errorf("Invalid ionice_level %v", param["ionice_level"])
+			}
+			attr.IONiceLevel = level
+		}
+	}
+
+	return attr, nil
+}
+
+// needHelper returns whether the attributes must be applied by the helper
+func (attr *ProcessAttr) needHelper() bool {
+	return attr.Umask >= 0 || len(attr.Rlimit) > 0 || attr.SetNice || attr.IONiceClass > 0
+}
+
+// RunProcessHelper runs as the helper process which waits for the priorities
+// applied by the daemon, sets the limits and umask, and then execs the
+// command. It returns false immediately if the current process is not
+// started as the helper
+func RunProcessHelper() bool {
+	umask, ok := os.LookupEnv(processHelperEnv)
+	if !ok {
+		return false
+	}
+	os.Unsetenv(processHelperEnv)
+
+	err := runProcessHelper(umask)
+	fmt.Fprintf(os.Stderr, "Herald process helper error: %s\n", err)
+	os.Exit(127)
+	return true
+}
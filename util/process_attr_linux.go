@@ -0,0 +1,283 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+	"as":     syscall.RLIMIT_AS,
+	"cpu":    syscall.RLIMIT_CPU,
+	"core":   syscall.RLIMIT_CORE,
+}
+
+const ioprioWhoProcess = 1
+
+func ioprioSet(pid, class, level int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(class<<13|level))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func lookupCredential(username, groupname string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{
+		Uid: uint32(os.Geteuid()),
+		Gid: uint32(os.Getegid()),
+	}
+
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			u, err = user.LookupId(username)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`User "%s" not found`, username)
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		cred.Uid = uint32(uid)
+		cred.Gid = uint32(gid)
+
+		groupIDs, err := u.GroupIds()
+		if err == nil {
+			for _, groupID := range groupIDs {
+				id, err := strconv.ParseUint(groupID, 10, 32)
+				if err == nil {
+					cred.Groups = append(cred.Groups, uint32(id))
+				}
+			}
+		}
+	}
+
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			g, err = user.LookupGroupId(groupname)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`Group "%s" not found`, groupname)
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		cred.Gid = uint32(gid)
+	}
+
+	return cred, nil
+}
+
+// checkPrivilege refuses the attributes which the daemon is not allowed to set
+func (attr *ProcessAttr) checkPrivilege(cred *syscall.Credential) error {
+	if os.Geteuid() != 0 {
+		if cred != nil && (int(cred.Uid) != os.Geteuid() || int(cred.Gid) != os.Getegid()) {
+			return errors.New("Changing user or group requires root privilege")
+		}
+		if attr.SetNice && attr.Nice < 0 {
+			return errors.New("Negative nice requires root privilege")
+		}
+		if attr.IONiceClass == ioniceClasses["realtime"] {
+			return errors.New("Realtime ionice class requires root privilege")
+		}
+	} else if cred == nil || cred.Uid == 0 {
+		return nil
+	}
+
+	// The rlimits are set by the helper as the user of the command
+	for name, limit := range attr.Rlimit {
+		var current syscall.Rlimit
+		err := syscall.Getrlimit(rlimitResources[name], &current)
+		if err != nil {
+			return fmt.Errorf(`Get rlimit "%s" error: %s`, name, err)
+		}
+		if limit > uint64(current.Max) {
+			return fmt.Errorf(`Raising rlimit "%s" over the hard limit of the daemon is not allowed`, name)
+		}
+	}
+
+	return nil
+}
+
+// chown changes the owner of the file to the user and group of the command
+func (attr *ProcessAttr) chown(path string) error {
+	if attr.User == "" && attr.Group == "" {
+		return nil
+	}
+	cred, err := lookupCredential(attr.User, attr.Group)
+	if err != nil {
+		return err
+	}
+	if int(cred.Uid) == os.Geteuid() && int(cred.Gid) == os.Getegid() {
+		return nil
+	}
+	return os.Chown(path, int(cred.Uid), int(cred.Gid))
+}
+
+// processHelper keeps the pipe which holds the helper before exec
+type processHelper struct {
+	r *os.File
+	w *os.File
+}
+
+// prepare sets the credential, and replaces the command with
+// the helper if the other attributes are specified
+func (attr *ProcessAttr) prepare(cmd *exec.Cmd) (*processHelper, error) {
+	var cred *syscall.Credential
+	if attr.User != "" || attr.Group != "" {
+		var err error
+		cred, err = lookupCredential(attr.User, attr.Group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := attr.checkPrivilege(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred != nil && os.Geteuid() == 0 {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	if !attr.needHelper() {
+		return nil, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("Find daemon executable error: %s", err)
+	}
+
+	path := cmd.Args[0]
+	if !strings.Contains(path, "/") {
+		path, err = exec.LookPath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	umask := ""
+	if attr.Umask >= 0 {
+		umask = strconv.FormatInt(int64(attr.Umask), 8)
+	}
+
+	cmd.Path = self
+	cmd.Args = append([]string{self, path}, cmd.Args...)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, processHelperEnv+"="+umask)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.ExtraFiles = []*os.File{r}
+
+	return &processHelper{r: r, w: w}, nil
+}
+
+// processHelperAttr is sent to the helper through the pipe
+type processHelperAttr struct {
+	Rlimit map[string]uint64 `json:"rlimit,omitempty"`
+}
+
+// apply sets the priorities on the started helper, and releases it
+// with the limits, which are set by the helper itself
+func (attr *ProcessAttr) apply(pid int, helper *processHelper) error {
+	if helper == nil {
+		return nil
+	}
+	defer helper.w.Close()
+	helper.r.Close()
+
+	if attr.SetNice {
+		err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, attr.Nice)
+		if err != nil {
+			return fmt.Errorf("Set nice error: %s", err)
+		}
+	}
+
+	if attr.IONiceClass > 0 {
+		err := ioprioSet(pid, attr.IONiceClass, attr.IONiceLevel)
+		if err != nil {
+			return fmt.Errorf("Set ionice error: %s", err)
+		}
+	}
+
+	helperAttr, err := json.Marshal(&processHelperAttr{Rlimit: attr.Rlimit})
+	if err != nil {
+		return err
+	}
+	_, err = helper.w.Write(helperAttr)
+	return err
+}
+
+// close releases the pipe if the helper is not started
+func (helper *processHelper) close() {
+	if helper == nil {
+		return
+	}
+	helper.r.Close()
+	helper.w.Close()
+}
+
+func runProcessHelper(umask string) error {
+	f := os.NewFile(3, "herald-process-helper")
+	ready, _ := ioutil.ReadAll(f)
+	f.Close()
+	if len(ready) == 0 {
+		return errors.New("Process attributes not applied")
+	}
+
+	var helperAttr processHelperAttr
+	err := json.Unmarshal(ready, &helperAttr)
+	if err != nil {
+		return fmt.Errorf("Invalid process attributes: %s", err)
+	}
+
+	for name, limit := range helperAttr.Rlimit {
+		err := syscall.Setrlimit(rlimitResources[name], &syscall.Rlimit{Cur: limit, Max: limit})
+		if err != nil {
+			return fmt.Errorf(`Set rlimit "%s" error: %s`, name, err)
+		}
+	}
+
+	if umask != "" {
+		value, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil {
+			return err
+		}
+		syscall.Umask(int(value))
+	}
+
+	if len(os.Args) < 3 {
+		return errors.New("Command not specified")
+	}
+	for retry := 0; ; retry++ {
+		err = syscall.Exec(os.Args[1], os.Args[2:], os.Environ())
+		if !isTextBusy(err) || retry >= textBusyRetries {
+			return err
+		}
+		time.Sleep(textBusyRetryDelay)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var rlimitResources = map[string]int{
+	"nofile": 0,
+	"nproc":  0,
+	"as":     0,
+	"cpu":    0,
+	"core":   0,
+}
+
+type processHelper struct{}
+
+func (attr *ProcessAttr) chown(path string) error {
+	return nil
+}
+
+func (attr *ProcessAttr) prepare(cmd *exec.Cmd) (*processHelper, error) {
+	return nil, errors.New("Process attributes are only supported on Linux")
+}
+
+func (attr *ProcessAttr) apply(pid int, helper *processHelper) error {
+	return nil
+}
+
+func (helper *processHelper) close() {
+}
+
+func runProcessHelper(umask string) error {
+	return errors.New("Process helper is only supported on Linux")
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package util
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command run in a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcessGroup sends SIGTERM to the command and all processes in its group
+func terminateProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if err != nil {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+}
+
+// killProcessGroup kills the command and all processes in its group
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if err != nil {
+		cmd.Process.Kill()
+	}
+}
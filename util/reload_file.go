@@ -0,0 +1,56 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadFile keeps the content of a file and reloads it when modified
+type ReloadFile struct {
+	Path string
+
+	mutex   sync.Mutex
+	loaded  bool
+	exists  bool
+	modTime time.Time
+	size    int64
+	content []byte
+}
+
+// Load returns the content of the file, whether the file exists and
+// whether the file has been changed since last load
+func (f *ReloadFile) Load() ([]byte, bool, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	info, err := os.Stat(f.Path)
+	if os.IsNotExist(err) {
+		changed := !f.loaded || f.exists
+		f.loaded = true
+		f.exists = false
+		f.content = nil
+		return nil, false, changed, nil
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	if f.loaded && f.exists && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.content, true, false, nil
+	}
+
+	content, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	f.loaded = true
+	f.exists = true
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.content = content
+
+	return content, true, true, nil
+}
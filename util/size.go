@@ -0,0 +1,74 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"tib", 1 << 40},
+	{"kb", 1e3},
+	{"mb", 1e6},
+	{"gb", 1e9},
+	{"tb", 1e12},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseSize parses the size like "512MiB", "1.5GB" or "1G" into bytes,
+// number without unit is regarded as bytes
+func ParseSize(value interface{}) (float64, error) {
+	number, ok := ToFloat(value)
+	if ok {
+		return number, nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("Invalid size: %v", value)
+	}
+
+	s := strings.ToLower(strings.TrimSpace(text))
+	scale := 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			scale = unit.scale
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf(`Invalid size "%s"`, text)
+	}
+
+	return number * scale, nil
+}
+
+// ParseSizeOrPercent parses the size, or the percentage like "10%",
+// the bool result is true for percentage
+func ParseSizeOrPercent(value interface{}) (float64, bool, error) {
+	text, ok := value.(string)
+	if ok && strings.HasSuffix(strings.TrimSpace(text), "%") {
+		s := strings.TrimSuffix(strings.TrimSpace(text), "%")
+		percent, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, false, fmt.Errorf(`Invalid percentage "%s"`, text)
+		}
+		return percent, true, nil
+	}
+
+	size, err := ParseSize(value)
+	return size, false, err
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+)
+
+// ToStarlarkValue converts the param into frozen starlark value
+func ToStarlarkValue(v interface{}) (starlark.Value, error) {
+	switch value := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(value), nil
+	case string:
+		return starlark.String(value), nil
+	case int:
+		return starlark.MakeInt(value), nil
+	case int64:
+		return starlark.MakeInt64(value), nil
+	case uint64:
+		return starlark.MakeUint64(value), nil
+	case float64:
+		return starlark.Float(value), nil
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(value))
+		for _, item := range value {
+			elem, err := ToStarlarkValue(item)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		list := starlark.NewList(elems)
+		list.Freeze()
+		return list, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(value))
+		for _, k := range keys {
+			item, err := ToStarlarkValue(value[k])
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(k), item)
+		}
+		dict.Freeze()
+		return dict, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported type %T", v)
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LoadStateFile loads the json state file into v
+func LoadStateFile(fn string, v interface{}) error {
+	content, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// SaveStateFile saves v into the json state file atomically
+func SaveStateFile(fn string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	err = os.Rename(tmpName, fn)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
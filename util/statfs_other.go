@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package util
+
+import (
+	"errors"
+)
+
+// ReadDiskUsage is not supported on this platform
+func ReadDiskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.New("Disk usage is not supported on this platform")
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package util
+
+import (
+	"syscall"
+)
+
+// ReadDiskUsage gets the filesystem usage of the path
+func ReadDiskUsage(path string) (DiskUsage, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+
+	blockSize := uint64(stat.Bsize)
+
+	return DiskUsage{
+		Total:      uint64(stat.Blocks) * blockSize,
+		Free:       uint64(stat.Bfree) * blockSize,
+		Available:  uint64(stat.Bavail) * blockSize,
+		Inodes:     uint64(stat.Files),
+		InodesFree: uint64(stat.Ffree),
+	}, nil
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DiskUsage is the usage of a filesystem
+type DiskUsage struct {
+	Total      uint64
+	Free       uint64
+	Available  uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// ReadLoadAvg reads load averages from /proc/loadavg
+func ReadLoadAvg() (float64, float64, float64, error) {
+	content, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("Invalid loadavg format: %s", content)
+	}
+
+	var loads [3]float64
+	for i := range loads {
+		loads[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return loads[0], loads[1], loads[2], nil
+}
+
+// ReadMemInfo reads /proc/meminfo and returns the values in bytes
+func ReadMemInfo() (map[string]uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	memInfo := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			value *= 1024
+		}
+		memInfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return memInfo, nil
+}
+
+// ReadPressure reads the pressure stall information of cpu, memory or io
+// from /proc/pressure, like result["some"]["avg10"]
+func ReadPressure(resource string) (map[string]map[string]float64, error) {
+	content, err := ioutil.ReadFile("/proc/pressure/" + resource)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]float64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		values := make(map[string]float64)
+		for _, field := range fields[1:] {
+			frags := strings.SplitN(field, "=", 2)
+			if len(frags) != 2 {
+				continue
+			}
+			value, err := strconv.ParseFloat(frags[1], 64)
+			if err != nil {
+				continue
+			}
+			values[frags[0]] = value
+		}
+		result[fields[0]] = values
+	}
+
+	return result, nil
+}
+
+// CountProcesses counts the processes from /proc
+func CountProcesses() (int, error) {
+	files, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		_, err := strconv.Atoi(f.Name())
+		if err == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func usedPercent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(total)
+}
+
+// CollectSystemMetrics collects the load, memory, swap, process and
+// filesystem metrics, filesystems are specified by name and path
+func CollectSystemMetrics(mounts map[string]string) (map[string]interface{}, error) {
+	metrics := make(map[string]interface{})
+
+	load1, load5, load15, err := ReadLoadAvg()
+	if err != nil {
+		return nil, fmt.Errorf("Read load average error: %s", err)
+	}
+	metrics["load"] = map[string]interface{}{
+		"load1":  load1,
+		"load5":  load5,
+		"load15": load15,
+	}
+
+	memInfo, err := ReadMemInfo()
+	if err != nil {
+		return nil, fmt.Errorf("Read memory info error: %s", err)
+	}
+	memTotal := memInfo["MemTotal"]
+	memAvailable, ok := memInfo["MemAvailable"]
+	if !ok {
+		memAvailable = memInfo["MemFree"] + memInfo["Buffers"] + memInfo["Cached"]
+	}
+	metrics["memory"] = map[string]interface{}{
+		"total":        memTotal,
+		"available":    memAvailable,
+		"used":         memTotal - memAvailable,
+		"used_percent": usedPercent(memTotal-memAvailable, memTotal),
+	}
+	swapTotal := memInfo["SwapTotal"]
+	swapFree := memInfo["SwapFree"]
+	metrics["swap"] = map[string]interface{}{
+		"total":        swapTotal,
+		"free":         swapFree,
+		"used":         swapTotal - swapFree,
+		"used_percent": usedPercent(swapTotal-swapFree, swapTotal),
+	}
+
+	processCount, err := CountProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("Count processes error: %s", err)
+	}
+	metrics["process"] = map[string]interface{}{
+		"count": processCount,
+	}
+
+	filesystems := make(map[string]interface{})
+	for name, path := range mounts {
+		usage, err := ReadDiskUsage(path)
+		if err != nil {
+			return nil, fmt.Errorf(`Read disk usage of "%s" error: %s`, path, err)
+		}
+		filesystems[name] = map[string]interface{}{
+			"path":                path,
+			"total":               usage.Total,
+			"free":                usage.Free,
+			"available":           usage.Available,
+			"used":                usage.Total - usage.Free,
+			"used_percent":        usedPercent(usage.Total-usage.Free, usage.Total-usage.Free+usage.Available),
+			"inodes":              usage.Inodes,
+			"inodes_free":         usage.InodesFree,
+			"inodes_used_percent": usedPercent(usage.Inodes-usage.InodesFree, usage.Inodes),
+		}
+	}
+	metrics["filesystem"] = filesystems
+
+	return metrics, nil
+}
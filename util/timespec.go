@@ -0,0 +1,96 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+const dateLayout = "2006-01-02"
+
+// ParseTime parses the time in common layouts,
+// the location is used if no time zone in the text
+func ParseTime(text string, loc *time.Location) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, text, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`Invalid time "%s"`, text)
+}
+
+// ParseDate parses the date like "2006-01-02"
+func ParseDate(text string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(dateLayout, strings.TrimSpace(text), loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`Invalid date "%s"`, text)
+	}
+	return t, nil
+}
+
+// DateRange is a range of dates including both ends
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseDateRange parses the date range like "2006-01-02..2006-01-05"
+// or a single date like "2006-01-02"
+func ParseDateRange(text string, loc *time.Location) (DateRange, error) {
+	frags := strings.SplitN(text, "..", 2)
+
+	start, err := ParseDate(frags[0], loc)
+	if err != nil {
+		return DateRange{}, err
+	}
+
+	end := start
+	if len(frags) > 1 {
+		end, err = ParseDate(frags[1], loc)
+		if err != nil {
+			return DateRange{}, err
+		}
+	}
+
+	return DateRange{
+		Start: start,
+		End:   end,
+	}, nil
+}
+
+// Contains checks whether the date of t is in the range
+func (r DateRange) Contains(t time.Time) bool {
+	date := t.In(r.Start.Location()).Format(dateLayout)
+	return date >= r.Start.Format(dateLayout) && date <= r.End.Format(dateLayout)
+}
+
+// ParseDateRanges parses a list of date ranges
+func ParseDateRanges(texts []string, loc *time.Location) ([]DateRange, error) {
+	ranges := make([]DateRange, 0, len(texts))
+	for _, text := range texts {
+		r, err := ParseDateRange(text, loc)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// LoadLocation loads the time zone, local time zone is used if empty
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}